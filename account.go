@@ -0,0 +1,223 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/auth"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+// Deleted accounts can be recovered by logging in until the grace period
+// ends, after which purgeDeletedAccounts removes them for good.
+const accountDeletionGrace = 30 * 24 * time.Hour
+
+func (cfg *apiConfig) handlerDeleteMe(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+	type deleteRequest struct {
+		Password    string `json:"password"`
+		ReauthToken string `json:"reauth_token"`
+	}
+
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 500, "Error reading request body", err)
+		return
+	}
+
+	rq := deleteRequest{}
+	err = json.Unmarshal(data, &rq)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshaling json", err)
+		return
+	}
+
+	if !cfg.confirmAccountOwner(w, r, userId, rq.Password, rq.ReauthToken) {
+		return
+	}
+
+	deletion, err := cfg.db.ScheduleAccountDeletion(r.Context(), database.ScheduleAccountDeletionParams{
+		UserID:      userId,
+		DeleteAfter: time.Now().Add(accountDeletionGrace),
+	})
+	if err != nil {
+		respondWithError(w, 400, "Error scheduling account deletion", err)
+		return
+	}
+
+	// Sign out everywhere; logging in again cancels the deletion.
+	err = cfg.db.RevokeAllForUser(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 500, "Error revoking sessions", err)
+		return
+	}
+	err = cfg.db.RevokeAllAPIKeysForUser(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 500, "Error revoking api keys", err)
+		return
+	}
+
+	respondWithJson(w, 202, responseAccountDeletion{DeleteAfter: deletion.DeleteAfter})
+}
+
+// confirmAccountOwner checks the password, or for accounts created through an
+// identity provider, a reauth token from /api/auth/oidc/start?purpose=reauth.
+// On failure the error response is already written.
+func (cfg *apiConfig) confirmAccountOwner(w http.ResponseWriter, r *http.Request, userId uuid.UUID, password, reauthToken string) bool {
+	if reauthToken != "" {
+		tokenUserId, err := auth.ValidateReauthToken(reauthToken, cfg.jwtKeys)
+		if err != nil || tokenUserId != userId {
+			respondWithError(w, 401, "Invalid or expired reauth token", err)
+			return false
+		}
+		return true
+	}
+
+	user, err := cfg.db.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 404, "User doesn't exist", err)
+		return false
+	}
+	keys := cfg.loginKeys(r, user.Email)
+	lockedUntil, err := cfg.loginLockedUntil(r.Context(), keys)
+	if err != nil {
+		respondWithError(w, 500, "Error checking login attempts", err)
+		return false
+	}
+	if !lockedUntil.IsZero() {
+		respondLoginLocked(w, lockedUntil)
+		return false
+	}
+	err = auth.CheckPasswordHash(password, user.HashedPassword)
+	if err != nil {
+		cfg.recordFailedLogin(r.Context(), keys)
+		respondWithError(w, 401, "Incorrect password", err)
+		return false
+	}
+	return true
+}
+
+// cancelAccountDeletion is called on every successful login.
+func (cfg *apiConfig) cancelAccountDeletion(ctx context.Context, userId uuid.UUID) {
+	cancelled, err := cfg.db.CancelAccountDeletion(ctx, userId)
+	if err != nil {
+		log.Printf("Error cancelling account deletion for user %v: %v", userId, err)
+		return
+	}
+	if cancelled > 0 {
+		log.Printf("Account deletion for user %v cancelled by login", userId)
+	}
+}
+
+func (cfg *apiConfig) purgeDeletedAccounts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deleted, err := cfg.purgeDueAccounts(ctx)
+		if err != nil {
+			log.Printf("Error purging deleted accounts: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Purged %d deleted accounts", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDueAccounts removes every account whose grace period has ended. Their
+// chirps go with them, except those with replies, which stay behind as
+// tombstones without an author so the threads below them stay intact.
+func (cfg *apiConfig) purgeDueAccounts(ctx context.Context) (int64, error) {
+	var deleted int64
+	err := cfg.withTx(ctx, func(q *database.Queries) error {
+		err := q.TombstoneDueAccountChirps(ctx)
+		if err != nil {
+			return err
+		}
+		deleted, err = q.DeleteDueAccounts(ctx)
+		return err
+	})
+	return deleted, err
+}
+
+// handlerExportMe streams a ZIP archive with one JSON file per kind of data
+// held about the caller.
+func (cfg *apiConfig) handlerExportMe(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+
+	user, err := cfg.db.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 404, "User doesn't exist", err)
+		return
+	}
+	dbChirps, err := cfg.db.ListChirpsForExport(r.Context(), uuid.NullUUID{UUID: userId, Valid: true})
+	if err != nil {
+		respondWithError(w, 400, "Error getting chirps", err)
+		return
+	}
+	likes, err := cfg.db.ListLikesByUser(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 400, "Error getting likes", err)
+		return
+	}
+	tokens, err := cfg.db.ListActiveSessions(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 400, "Error getting sessions", err)
+		return
+	}
+
+	chirps := make([]responseChirp, len(dbChirps))
+	for i, c := range dbChirps {
+		chirps[i] = *NewResponseChirp(c)
+	}
+	exportLikes := make([]responseExportLike, len(likes))
+	for i, l := range likes {
+		exportLikes[i] = responseExportLike{ChirpID: l.ChirpID, LikedAt: l.CreatedAt}
+	}
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", NewResponseUser(user, "", "")},
+		{"chirps.json", chirps},
+		{"likes.json", exportLikes},
+		{"sessions.json", newResponseSessions(tokens)},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, time.Now().UTC().Format("2006-01-02")))
+	w.WriteHeader(200)
+
+	// The status is sent, so failures past this point can only be logged.
+	archive := zip.NewWriter(w)
+	for _, f := range files {
+		entry, err := archive.Create(f.name)
+		if err != nil {
+			log.Printf("Error writing export for user %v: %v", userId, err)
+			return
+		}
+		enc := json.NewEncoder(entry)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(f.data)
+		if err != nil {
+			log.Printf("Error writing export for user %v: %v", userId, err)
+			return
+		}
+	}
+	err = archive.Close()
+	if err != nil {
+		log.Printf("Error writing export for user %v: %v", userId, err)
+	}
+}
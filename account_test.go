@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/auth"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+func TestHandlerDeleteMeSchedulesDeletion(t *testing.T) {
+	cfg, mock := newTestConfig(t)
+	cfg.jwtKeys = auth.NewHMACKeySet("secret")
+	userId := uuid.New()
+	reauthToken, err := auth.MakeReauthToken(userId, cfg.jwtKeys, reauthTokenTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteAfter := time.Now().Add(accountDeletionGrace)
+
+	mock.ExpectQuery("INSERT INTO account_deletions").WithArgs(userId, sqlmock.AnyArg()).
+		WillReturnRows(mockRows(database.AccountDeletion{UserID: userId, RequestedAt: time.Now(), DeleteAfter: deleteAfter}))
+	mock.ExpectExec("UPDATE refresh_tokens").WithArgs(userId).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE api_keys").WithArgs(userId).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := httptest.NewRequest("DELETE", "/api/users/me", strings.NewReader(`{"reauth_token":"`+reauthToken+`"}`))
+	req = req.WithContext(context.WithValue(req.Context(), "userId", userId))
+	rec := httptest.NewRecorder()
+	cfg.handlerDeleteMe(rec, req)
+
+	if rec.Code != 202 {
+		t.Errorf("status = %d, want 202", rec.Code)
+	}
+}
+
+func TestRespondWithLoginCancelsDeletion(t *testing.T) {
+	cfg, mock := newTestConfig(t)
+	cfg.jwtKeys = auth.NewHMACKeySet("secret")
+	user := database.User{ID: uuid.New(), Email: "bob@example.com", Role: string(auth.RoleUser)}
+
+	mock.ExpectExec("DELETE FROM account_deletions").WithArgs(user.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM login_attempts").WithArgs(accountLoginKey(user.Email)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("INSERT INTO refresh_tokens").
+		WillReturnRows(mockRows(database.RefreshToken{TokenHash: "hash", UserID: user.ID, FamilyID: uuid.New()}))
+
+	rec := httptest.NewRecorder()
+	cfg.respondWithLogin(rec, httptest.NewRequest("POST", "/api/login", nil), user)
+
+	if rec.Code != 200 {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+}
+
+func TestPurgeDueAccounts(t *testing.T) {
+	t.Run("tombstones replied chirps before deleting", func(t *testing.T) {
+		cfg, mock := newTestConfig(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE chirps").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("DELETE FROM users").WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectCommit()
+
+		deleted, err := cfg.purgeDueAccounts(context.Background())
+		if err != nil || deleted != 3 {
+			t.Errorf("purgeDueAccounts() = %d, %v, want 3, nil", deleted, err)
+		}
+	})
+
+	t.Run("keeps accounts when tombstoning fails", func(t *testing.T) {
+		cfg, mock := newTestConfig(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE chirps").WillReturnError(errors.New("boom"))
+		mock.ExpectRollback()
+
+		_, err := cfg.purgeDueAccounts(context.Background())
+		if err == nil {
+			t.Error("purgeDueAccounts() error = nil, want the tombstone error")
+		}
+	})
+}
+
+func TestMiddlewareAuthorizePendingDeletion(t *testing.T) {
+	tests := []struct {
+		name       string
+		pending    bool
+		wantStatus int
+	}{
+		{name: "active account", pending: false, wantStatus: 204},
+		{name: "pending deletion", pending: true, wantStatus: 401},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			cfg.jwtKeys = auth.NewHMACKeySet("secret")
+			userId := uuid.New()
+			token, err := auth.MakeJWT(userId, auth.RoleUser, cfg.jwtKeys, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mock.ExpectQuery("FROM account_deletions").WithArgs(userId).
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(tt.pending))
+
+			handler := cfg.middlewareAuthorize(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(204)
+			})
+			req := httptest.NewRequest("POST", "/api/chirps", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestMiddlewareIdentifyPendingDeletion(t *testing.T) {
+	tests := []struct {
+		name       string
+		pending    bool
+		wantCaller bool
+	}{
+		{name: "active account", pending: false, wantCaller: true},
+		{name: "pending deletion is anonymous", pending: true, wantCaller: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			cfg.jwtKeys = auth.NewHMACKeySet("secret")
+			userId := uuid.New()
+			token, err := auth.MakeJWT(userId, auth.RoleUser, cfg.jwtKeys, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mock.ExpectQuery("FROM account_deletions").WithArgs(userId).
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(tt.pending))
+
+			gotCaller := false
+			handler := cfg.middlewareIdentify(func(w http.ResponseWriter, r *http.Request) {
+				gotCaller = viewerIdFromContext(r.Context()).Valid
+			})
+			req := httptest.NewRequest("GET", "/api/chirps", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			handler(httptest.NewRecorder(), req)
+
+			if gotCaller != tt.wantCaller {
+				t.Errorf("caller identified = %v, want %v", gotCaller, tt.wantCaller)
+			}
+		})
+	}
+}
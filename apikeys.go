@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/auth"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+// Personal API keys are sent as "Authorization: ApiKey chirpy_...". They act
+// as their owner with plain user rights, limited to the key's scopes, until
+// they expire or are revoked. Logging out everywhere and resetting the
+// password revoke them too.
+
+func (cfg *apiConfig) handlerCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+	type apiKeyRequest struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 500, "Error reading request body", err)
+		return
+	}
+
+	rq := apiKeyRequest{}
+	err = json.Unmarshal(data, &rq)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshaling json", err)
+		return
+	}
+	if rq.Name == "" {
+		respondWithError(w, 400, "Name is required", nil)
+		return
+	}
+	scopes, err := auth.ParseScopes(rq.Scopes)
+	if err != nil {
+		respondWithError(w, 400, err.Error(), err)
+		return
+	}
+
+	expiresAt := sql.NullTime{}
+	if rq.ExpiresAt != nil {
+		if !rq.ExpiresAt.After(time.Now()) {
+			respondWithError(w, 400, "Expiry must be in the future", nil)
+			return
+		}
+		expiresAt = sql.NullTime{Time: *rq.ExpiresAt, Valid: true}
+	}
+
+	key, prefix, err := auth.MakeAPIKey()
+	if err != nil {
+		respondWithError(w, 500, "Error creating api key", err)
+		return
+	}
+	scopeNames := make([]string, len(scopes))
+	for i, s := range scopes {
+		scopeNames[i] = string(s)
+	}
+	apiKey, err := cfg.db.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID:    userId,
+		Name:      rq.Name,
+		KeyHash:   auth.HashToken(key),
+		Prefix:    prefix,
+		Scopes:    scopeNames,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, 400, "Error creating api key", err)
+		return
+	}
+
+	// The full key is only ever shown here.
+	rsKey := *NewResponseAPIKey(apiKey)
+	rsKey.Key = key
+	respondWithJson(w, 201, rsKey)
+}
+
+func (cfg *apiConfig) handlerListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+
+	apiKeys, err := cfg.db.ListAPIKeysForUser(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 400, "Error getting api keys", err)
+		return
+	}
+
+	rsKeys := make([]responseAPIKey, len(apiKeys))
+	for i, k := range apiKeys {
+		rsKeys[i] = *NewResponseAPIKey(k)
+	}
+	respondWithJson(w, 200, rsKeys)
+}
+
+func (cfg *apiConfig) handlerRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+	keyId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+
+	revoked, err := cfg.db.RevokeAPIKey(r.Context(), database.RevokeAPIKeyParams{ID: keyId, UserID: userId})
+	if err != nil {
+		respondWithError(w, 400, "Error revoking api key", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, 404, "API key doesn't exist", nil)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// authenticateAPIKey looks up a presented key and records its use.
+func (cfg *apiConfig) authenticateAPIKey(r *http.Request, key string) (database.ApiKey, error) {
+	apiKey, err := cfg.db.GetAPIKeyByHash(r.Context(), auth.HashToken(key))
+	if err != nil {
+		return database.ApiKey{}, err
+	}
+	err = cfg.db.TouchAPIKey(r.Context(), apiKey.ID)
+	if err != nil {
+		log.Printf("Error updating last use of api key %v: %v", apiKey.ID, err)
+	}
+	return apiKey, nil
+}
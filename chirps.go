@@ -1,26 +1,32 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
-	"sort"
 
 	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/auth"
 	"github.com/mikarwacki/chirpy/internal/database"
 )
 
 func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, req *http.Request) {
 	userId := req.Context().Value("userId").(uuid.UUID)
 	type chirp struct {
-		Body string `json:"body"`
+		Body    string     `json:"body"`
+		ReplyTo *uuid.UUID `json:"reply_to"`
+	}
+	if !cfg.requireVerifiedEmail(w, req, userId) {
+		return
 	}
 
 	defer req.Body.Close()
 	data, err := io.ReadAll(req.Body)
 	if err != nil {
 		respondWithError(w, 500, "Error reading request body", err)
+		return
 	}
 	log.Println(string(data))
 
@@ -31,87 +37,206 @@ func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	dbChirp, err := cfg.db.CreateChirp(req.Context(), database.CreateChirpParams{Body: chir.Body, UserID: userId})
+	createChirpParams := database.CreateChirpParams{Body: chir.Body, UserID: uuid.NullUUID{UUID: userId, Valid: true}}
+	if chir.ReplyTo != nil {
+		parent, err := cfg.db.GetChirpById(req.Context(), *chir.ReplyTo)
+		if err != nil || parent.DeletedAt.Valid {
+			respondWithError(w, 404, "Parent chirp doesn't exist", err)
+			return
+		}
+		createChirpParams.ParentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+
+	var dbChirp database.Chirp
+	err = cfg.withTx(req.Context(), func(q *database.Queries) error {
+		dbChirp, err = q.CreateChirp(req.Context(), createChirpParams)
+		if err != nil {
+			return err
+		}
+		err = indexChirpEntities(req.Context(), q, dbChirp)
+		if err != nil {
+			return err
+		}
+		return flagChirpIfNeeded(req.Context(), q, dbChirp)
+	})
 	if err != nil {
 		respondWithError(w, 400, "Error creating chirp", err)
+		return
 	}
 
-	rChirp := responseChirp{ID: dbChirp.ID, CreatedAt: dbChirp.CreatedAt, UpdatedAt: dbChirp.UpdatedAt, Body: dbChirp.Body, UserID: dbChirp.UserID}
-	respondWithJson(w, 201, rChirp)
+	respondWithJson(w, 201, *NewResponseChirp(dbChirp))
 }
 
 func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 	authorId := r.URL.Query().Get("author_id")
 	sortStrat := r.URL.Query().Get("sort")
 
-	var chirps []database.Chirp
-	var err error
-	if authorId == "" {
-		chirps, err = cfg.db.GetChirps(r.Context())
+	limit, err := parsePageLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid limit", err)
+		return
+	}
+
+	params := database.ListChirpsAscParams{ViewerID: viewerIdFromContext(r.Context()), Limit: limit + 1}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		pc, err := decodeCursor(cursor)
 		if err != nil {
-			respondWithError(w, 400, "Error getting chirps", err)
+			respondWithError(w, 400, "Invalid cursor", err)
 			return
 		}
-	} else {
-		userUuid, err := uuid.Parse(authorId)
+		params.CursorCreatedAt = pc.nullTime()
+		params.CursorID = pc.nullID()
+	}
+	if authorId != "" {
+		userUuid, err := cfg.resolveAuthorId(r.Context(), authorId)
 		if err != nil {
-			respondWithError(w, 400, "Error parsing author uuid", err)
+			respondWithError(w, 404, "Author doesn't exist", err)
 			return
 		}
+		params.UserID = uuid.NullUUID{UUID: userUuid, Valid: true}
+	}
 
-		chirps, err = cfg.db.GetChirpsByAuthor(r.Context(), userUuid)
+	var chirps []database.Chirp
+	if sortStrat == "desc" {
+		chirps, err = cfg.db.ListChirpsDesc(r.Context(), database.ListChirpsDescParams(params))
+	} else {
+		chirps, err = cfg.db.ListChirpsAsc(r.Context(), params)
+	}
+	if err != nil {
+		respondWithError(w, 400, "Error getting chirps", err)
+		return
+	}
+
+	page := newChirpPage(chirps, limit)
+	err = cfg.attachChirpStats(r.Context(), page.Chirps, viewerIdFromContext(r.Context()))
+	if err != nil {
+		respondWithError(w, 400, "Error getting chirp stats", err)
+		return
+	}
+	respondWithJson(w, 200, page)
+}
+
+func (cfg *apiConfig) handlerSearchChirps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	authorId := r.URL.Query().Get("author_id")
+	sortStrat := r.URL.Query().Get("sort")
+	if query == "" {
+		respondWithError(w, 400, "Search query is required", nil)
+		return
+	}
+
+	limit, err := parsePageLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid limit", err)
+		return
+	}
+
+	params := database.SearchChirpsParams{Query: query, Sort: sortStrat, Limit: limit}
+	if authorId != "" {
+		userUuid, err := cfg.resolveAuthorId(r.Context(), authorId)
 		if err != nil {
-			respondWithError(w, 400, "Error getting chirps", err)
+			respondWithError(w, 404, "Author doesn't exist", err)
 			return
 		}
+		params.UserID = uuid.NullUUID{UUID: userUuid, Valid: true}
 	}
 
-	rChirps := make([]responseChirp, len(chirps))
-	for i, chr := range chirps {
-		rChirps[i] = responseChirp{ID: chr.ID, CreatedAt: chr.CreatedAt, UpdatedAt: chr.UpdatedAt, Body: chr.Body, UserID: chr.UserID}
+	rows, err := cfg.db.SearchChirps(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 400, "Error searching chirps", err)
+		return
 	}
 
-	sort.Slice(rChirps, func(i, j int) bool {
-		if sortStrat == "desc" {
-			return rChirps[i].CreatedAt.After(rChirps[j].CreatedAt)
-		}
-		return rChirps[i].CreatedAt.Before(rChirps[j].CreatedAt)
-	})
-	respondWithJson(w, 200, rChirps)
+	rChirps := make([]responseChirp, len(rows))
+	for i, row := range rows {
+		rChirps[i] = responseChirp{ID: row.ID, CreatedAt: row.CreatedAt, UpdatedAt: row.UpdatedAt, Body: row.Body, UserID: row.UserID, ParentID: row.ParentID}
+	}
+	err = cfg.attachChirpStats(r.Context(), rChirps, viewerIdFromContext(r.Context()))
+	if err != nil {
+		respondWithError(w, 400, "Error getting chirp stats", err)
+		return
+	}
+
+	results := make([]responseChirpSearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = responseChirpSearchResult{responseChirp: rChirps[i], Rank: row.Rank, Snippet: row.Snippet}
+	}
+	respondWithJson(w, 200, results)
 }
 
 func (cfg *apiConfig) handlerGetChirpById(w http.ResponseWriter, r *http.Request) {
 	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
 	if err != nil {
 		respondWithError(w, 400, "Invalid chirp id", err)
+		return
 	}
 	chirp, err := cfg.db.GetChirpById(r.Context(), chirpId)
 	if err != nil {
 		respondWithError(w, 404, "Chirp doesn't exist", err)
+		return
 	}
+	if !cfg.chirpVisible(w, r, chirp) {
+		return
+	}
+	viewerId := viewerIdFromContext(r.Context())
 
-	rChirp := responseChirp{ID: chirp.ID, CreatedAt: chirp.CreatedAt, UpdatedAt: chirp.UpdatedAt, Body: chirp.Body, UserID: chirp.UserID}
-	respondWithJson(w, 200, rChirp)
+	rChirps := []responseChirp{*NewResponseChirp(chirp)}
+	err = cfg.attachChirpStats(r.Context(), rChirps, viewerId)
+	if err != nil {
+		respondWithError(w, 400, "Error getting chirp stats", err)
+		return
+	}
+	respondWithJson(w, 200, rChirps[0])
 }
 
-func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
-	userId := r.Context().Value("userId").(uuid.UUID)
+func (cfg *apiConfig) handlerGetChirpReplies(w http.ResponseWriter, r *http.Request) {
 	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
 	if err != nil {
-		respondWithError(w, 400, "Error parsing uuid", err)
+		respondWithError(w, 400, "Invalid chirp id", err)
 		return
 	}
-	dbChirp, err := cfg.db.GetChirpById(r.Context(), chirpId)
+
+	limit, err := parsePageLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid limit", err)
+		return
+	}
+
+	params := database.ListChirpRepliesParams{ParentID: uuid.NullUUID{UUID: chirpId, Valid: true}, Limit: limit + 1}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		pc, err := decodeCursor(cursor)
+		if err != nil {
+			respondWithError(w, 400, "Invalid cursor", err)
+			return
+		}
+		params.CursorCreatedAt = pc.nullTime()
+		params.CursorID = pc.nullID()
+	}
+
+	chirps, err := cfg.db.ListChirpReplies(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 400, "Error getting replies", err)
+		return
+	}
+
+	page := newChirpPage(chirps, limit)
+	err = cfg.attachChirpStats(r.Context(), page.Chirps, viewerIdFromContext(r.Context()))
 	if err != nil {
-		respondWithError(w, 400, "Chirp doesn't exist", err)
+		respondWithError(w, 400, "Error getting chirp stats", err)
 		return
 	}
+	respondWithJson(w, 200, page)
+}
 
-	if dbChirp.UserID != userId {
-		respondWithError(w, 403, "Current user isn't author of the chirp", err)
+func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	dbChirp, ok := cfg.getOwnedChirp(w, r)
+	if !ok {
 		return
 	}
-	err = cfg.db.DeleteChirpById(r.Context(), chirpId)
+
+	err := cfg.withTx(r.Context(), func(q *database.Queries) error {
+		return removeChirp(r.Context(), q, dbChirp.ID)
+	})
 	if err != nil {
 		respondWithError(w, 404, "Error deleting the chirp, chirp doesn't exist", err)
 		return
@@ -119,3 +244,162 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 
 	respondWithJson(w, 204, nil)
 }
+
+func (cfg *apiConfig) handlerUpdateChirp(w http.ResponseWriter, r *http.Request) {
+	type chirp struct {
+		Body string `json:"body"`
+	}
+
+	dbChirp, ok := cfg.getOwnedChirp(w, r)
+	if !ok {
+		return
+	}
+
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 500, "Error reading request body", err)
+		return
+	}
+
+	chir := chirp{}
+	err = json.Unmarshal(data, &chir)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshalling data", err)
+		return
+	}
+
+	var updated database.Chirp
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		// UpdateChirpBody records the previous body as a revision. Holding the
+		// row lock first makes concurrent edits queue up, so each one reads
+		// the body the edit before it wrote.
+		err := q.LockChirpById(r.Context(), dbChirp.ID)
+		if err != nil {
+			return err
+		}
+		updated, err = q.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{ID: dbChirp.ID, Body: chir.Body})
+		if err != nil {
+			return err
+		}
+		err = indexChirpEntities(r.Context(), q, updated)
+		if err != nil {
+			return err
+		}
+		return flagChirpIfNeeded(r.Context(), q, updated)
+	})
+	if err != nil {
+		respondWithError(w, 400, "Error updating chirp", err)
+		return
+	}
+
+	rChirps := []responseChirp{*NewResponseChirp(updated)}
+	err = cfg.attachChirpStats(r.Context(), rChirps, updated.UserID)
+	if err != nil {
+		respondWithError(w, 400, "Error getting chirp stats", err)
+		return
+	}
+	respondWithJson(w, 200, rChirps[0])
+}
+
+func (cfg *apiConfig) handlerGetChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid chirp id", err)
+		return
+	}
+	dbChirp, err := cfg.db.GetChirpById(r.Context(), chirpId)
+	if err != nil || dbChirp.DeletedAt.Valid {
+		respondWithError(w, 404, "Chirp doesn't exist", err)
+		return
+	}
+	if !cfg.chirpVisible(w, r, dbChirp) {
+		return
+	}
+
+	revisions, err := cfg.db.GetChirpRevisions(r.Context(), chirpId)
+	if err != nil {
+		respondWithError(w, 400, "Error getting revisions", err)
+		return
+	}
+
+	rRevisions := make([]responseChirpRevision, len(revisions))
+	for i, rev := range revisions {
+		rRevisions[i] = responseChirpRevision{ID: rev.ID, ChirpID: rev.ChirpID, Body: rev.Body, CreatedAt: rev.CreatedAt}
+	}
+	respondWithJson(w, 200, rRevisions)
+}
+
+// getOwnedChirp loads the chirp named in the path and checks that the
+// authorized user wrote it. On failure the error response is already written.
+func (cfg *apiConfig) getOwnedChirp(w http.ResponseWriter, r *http.Request) (database.Chirp, bool) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return database.Chirp{}, false
+	}
+	dbChirp, err := cfg.db.GetChirpById(r.Context(), chirpId)
+	if err != nil || dbChirp.DeletedAt.Valid {
+		respondWithError(w, 404, "Chirp doesn't exist", err)
+		return database.Chirp{}, false
+	}
+
+	if dbChirp.UserID.UUID != userId {
+		respondWithError(w, 403, "Current user isn't author of the chirp", nil)
+		return database.Chirp{}, false
+	}
+	return dbChirp, true
+}
+
+// chirpVisible applies canViewChirp and hides chirps whose author has
+// scheduled their account for deletion. On failure the error response is
+// already written.
+func (cfg *apiConfig) chirpVisible(w http.ResponseWriter, r *http.Request, chirp database.Chirp) bool {
+	if !canViewChirp(r.Context(), chirp) {
+		respondWithError(w, 404, "Chirp doesn't exist", nil)
+		return false
+	}
+	pending, err := cfg.db.IsAccountPendingDeletion(r.Context(), chirp.UserID.UUID)
+	if err != nil {
+		respondWithError(w, 400, "Error getting chirp", err)
+		return false
+	}
+	if pending {
+		respondWithError(w, 404, "Chirp doesn't exist", nil)
+		return false
+	}
+	return true
+}
+
+// canViewChirp hides chirps taken down by moderators from everyone except
+// their author and the moderators and admins who review them.
+func canViewChirp(ctx context.Context, chirp database.Chirp) bool {
+	if !chirp.HiddenAt.Valid {
+		return true
+	}
+	if viewerId := viewerIdFromContext(ctx); viewerId.Valid && viewerId == chirp.UserID {
+		return true
+	}
+	role, _ := ctx.Value("userRole").(auth.Role)
+	return role.AtLeast(auth.RoleModerator)
+}
+
+// removeChirp deletes a chirp outright unless it has replies, in which case
+// the row is kept as a tombstone so the thread stays intact. The chirp row is
+// locked first so a reply can't be added between the count and the delete,
+// which means q has to belong to a transaction.
+func removeChirp(ctx context.Context, q *database.Queries, chirpId uuid.UUID) error {
+	err := q.LockChirpById(ctx, chirpId)
+	if err != nil {
+		return err
+	}
+	replies, err := q.CountChirpReplies(ctx, uuid.NullUUID{UUID: chirpId, Valid: true})
+	if err != nil {
+		return err
+	}
+	if replies > 0 {
+		return q.TombstoneChirpById(ctx, chirpId)
+	}
+	return q.DeleteChirpById(ctx, chirpId)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/auth"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+func TestRemoveChirp(t *testing.T) {
+	tests := []struct {
+		name    string
+		replies int64
+		remove  string
+	}{
+		{name: "without replies deletes", replies: 0, remove: "DELETE FROM chirps"},
+		{name: "with replies tombstones", replies: 2, remove: "UPDATE chirps"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			chirpId := uuid.New()
+
+			mock.ExpectBegin()
+			mock.ExpectExec("FOR UPDATE").WithArgs(chirpId).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery("SELECT COUNT").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.replies))
+			mock.ExpectExec(tt.remove).WithArgs(chirpId).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			err := cfg.withTx(context.Background(), func(q *database.Queries) error {
+				return removeChirp(context.Background(), q, chirpId)
+			})
+			if err != nil {
+				t.Fatalf("removeChirp() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestCanViewChirp(t *testing.T) {
+	authorId := uuid.New()
+	hiddenAt := sql.NullTime{Time: time.Now(), Valid: true}
+	tests := []struct {
+		name     string
+		hiddenAt sql.NullTime
+		viewerId uuid.UUID
+		role     auth.Role
+		want     bool
+	}{
+		{name: "visible chirp", want: true},
+		{name: "anonymous", hiddenAt: hiddenAt, want: false},
+		{name: "other user", hiddenAt: hiddenAt, viewerId: uuid.New(), role: auth.RoleUser, want: false},
+		{name: "author", hiddenAt: hiddenAt, viewerId: authorId, role: auth.RoleUser, want: true},
+		{name: "moderator", hiddenAt: hiddenAt, viewerId: uuid.New(), role: auth.RoleModerator, want: true},
+		{name: "admin", hiddenAt: hiddenAt, viewerId: uuid.New(), role: auth.RoleAdmin, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.viewerId != uuid.Nil {
+				ctx = context.WithValue(ctx, "userId", tt.viewerId)
+				ctx = context.WithValue(ctx, "userRole", tt.role)
+			}
+			chirp := database.Chirp{ID: uuid.New(), UserID: uuid.NullUUID{UUID: authorId, Valid: true}, HiddenAt: tt.hiddenAt}
+			if got := canViewChirp(ctx, chirp); got != tt.want {
+				t.Errorf("canViewChirp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handlerFollowUser(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+	followeeId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+	if followeeId == userId {
+		respondWithError(w, 400, "Users can't follow themselves", nil)
+		return
+	}
+
+	err = cfg.db.FollowUser(r.Context(), database.FollowUserParams{FollowerID: userId, FolloweeID: followeeId})
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			respondWithError(w, 404, "User doesn't exist", err)
+			return
+		}
+		respondWithError(w, 400, "Error following user", err)
+		return
+	}
+	respondWithJson(w, 204, nil)
+}
+
+func (cfg *apiConfig) handlerUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+	followeeId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+
+	err = cfg.db.UnfollowUser(r.Context(), database.UnfollowUserParams{FollowerID: userId, FolloweeID: followeeId})
+	if err != nil {
+		respondWithError(w, 400, "Error unfollowing user", err)
+		return
+	}
+	respondWithJson(w, 204, nil)
+}
+
+func (cfg *apiConfig) handlerGetFollowers(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+
+	follows, err := cfg.db.GetFollowers(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 400, "Error getting followers", err)
+		return
+	}
+
+	rFollows := make([]responseFollow, len(follows))
+	for i, f := range follows {
+		rFollows[i] = responseFollow{UserID: f.FollowerID, FollowedAt: f.CreatedAt}
+	}
+	respondWithJson(w, 200, rFollows)
+}
+
+func (cfg *apiConfig) handlerGetFollowing(w http.ResponseWriter, r *http.Request) {
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+
+	follows, err := cfg.db.GetFollowing(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 400, "Error getting followed users", err)
+		return
+	}
+
+	rFollows := make([]responseFollow, len(follows))
+	for i, f := range follows {
+		rFollows[i] = responseFollow{UserID: f.FolloweeID, FollowedAt: f.CreatedAt}
+	}
+	respondWithJson(w, 200, rFollows)
+}
+
+func (cfg *apiConfig) handlerGetTimeline(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+
+	limit, err := parsePageLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid limit", err)
+		return
+	}
+
+	params := database.ListTimelineChirpsParams{FollowerID: userId, Limit: limit + 1}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		pc, err := decodeCursor(cursor)
+		if err != nil {
+			respondWithError(w, 400, "Invalid cursor", err)
+			return
+		}
+		params.CursorCreatedAt = pc.nullTime()
+		params.CursorID = pc.nullID()
+	}
+
+	chirps, err := cfg.db.ListTimelineChirps(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 400, "Error getting timeline", err)
+		return
+	}
+
+	page := newChirpPage(chirps, limit)
+	err = cfg.attachChirpStats(r.Context(), page.Chirps, uuid.NullUUID{UUID: userId, Valid: true})
+	if err != nil {
+		respondWithError(w, 400, "Error getting chirp stats", err)
+		return
+	}
+	respondWithJson(w, 200, page)
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
@@ -3,6 +3,7 @@ module github.com/mikarwacki/chirpy
 go 1.23.3
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
 	github.com/google/uuid v1.6.0
 	github.com/lib/pq v1.10.9
 )
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"fmt"
+)
+
+type Scope string
+
+const (
+	ScopeChirpsRead  Scope = "chirps:read"
+	ScopeChirpsWrite Scope = "chirps:write"
+	ScopeProfileRead Scope = "profile:read"
+)
+
+// apiKeyPrefix marks personal API keys so they are easy to spot in code and
+// logs and can't be confused with refresh tokens.
+const apiKeyPrefix = "chirpy_"
+
+var knownScopes = map[Scope]bool{ScopeChirpsRead: true, ScopeChirpsWrite: true, ScopeProfileRead: true}
+
+// ParseScopes validates and deduplicates requested scopes, keeping their
+// order. At least one scope is required.
+func ParseScopes(raw []string) ([]Scope, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	seen := map[Scope]bool{}
+	scopes := make([]Scope, 0, len(raw))
+	for _, s := range raw {
+		scope := Scope(s)
+		if !knownScopes[scope] {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+func HasScope(scopes []string, want Scope) bool {
+	for _, s := range scopes {
+		if Scope(s) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// MakeAPIKey returns a new key and the short prefix shown when listing keys.
+// Only HashToken(key) is stored.
+func MakeAPIKey() (key string, displayPrefix string, err error) {
+	random, err := MakeOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + random
+	return key, key[:len(apiKeyPrefix)+8], nil
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     []string
+		want    []Scope
+		wantErr bool
+	}{
+		{
+			name: "Known scopes",
+			raw:  []string{"chirps:read", "chirps:write"},
+			want: []Scope{ScopeChirpsRead, ScopeChirpsWrite},
+		},
+		{
+			name: "Duplicates removed",
+			raw:  []string{"profile:read", "profile:read"},
+			want: []Scope{ScopeProfileRead},
+		},
+		{
+			name:    "Unknown scope",
+			raw:     []string{"chirps:read", "admin"},
+			wantErr: true,
+		},
+		{
+			name:    "No scopes",
+			raw:     nil,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScopes(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMakeAPIKey(t *testing.T) {
+	key, prefix, err := MakeAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) || !strings.HasPrefix(key, prefix) || len(prefix) != 15 {
+		t.Errorf("MakeAPIKey() = %q, %q", key, prefix)
+	}
+	if HasScope([]string{"chirps:read"}, ScopeChirpsWrite) {
+		t.Error("HasScope() = true for a missing scope")
+	}
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -18,11 +19,54 @@ import (
 type TokenType string
 
 const (
-	TokenTypeAccess TokenType = "chirpy-access"
+	TokenTypeAccess            TokenType = "chirpy-access"
+	TokenTypeEmailVerification TokenType = "chirpy-email-verification"
+	TokenTypeMFAChallenge      TokenType = "chirpy-mfa-challenge"
+	TokenTypeReauth            TokenType = "chirpy-reauth"
 )
 
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRanks = map[Role]int{RoleUser: 0, RoleModerator: 1, RoleAdmin: 2}
+
+func ParseRole(s string) (Role, error) {
+	if _, ok := roleRanks[Role(s)]; !ok {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+	return Role(s), nil
+}
+
+// AtLeast reports whether r grants every permission of min. Unknown roles are
+// treated as plain users.
+func (r Role) AtLeast(min Role) bool {
+	return roleRanks[r] >= roleRanks[min]
+}
+
+type accessClaims struct {
+	Role Role `json:"role"`
+	jwt.RegisteredClaims
+}
+
+var passwordCost = bcrypt.DefaultCost
+
+// SetPasswordCost changes the bcrypt cost used for new hashes. Existing hashes
+// with a different cost are upgraded on the next login, see NeedsRehash.
+func SetPasswordCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	passwordCost = cost
+	return nil
+}
+
 func HashPassword(password string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), len(password))
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
 	if err != nil {
 		log.Printf("Error hashing password: %v\n", err)
 		return "", err
@@ -30,6 +74,13 @@ func HashPassword(password string) (string, error) {
 	return string(hashed), nil
 }
 
+// NeedsRehash reports whether hash was made with a cost other than the
+// configured one.
+func NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != passwordCost
+}
+
 func CheckPasswordHash(password, hash string) error {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	if err != nil {
@@ -39,15 +90,16 @@ func CheckPasswordHash(password, hash string) error {
 	return nil
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    string(TokenTypeAccess),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
+func MakeJWT(userID uuid.UUID, role Role, keys *KeySet, expiresIn time.Duration) (string, error) {
+	tokenString, err := keys.sign(accessClaims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeAccess),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
 	})
-
-	tokenString, err := token.SignedString([]byte(tokenSecret))
 	if err != nil {
 		log.Printf("Error signing JWT %v", err)
 		return "", err
@@ -55,36 +107,39 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return tokenString, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := &jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+func ValidateJWT(tokenString string, keys *KeySet) (uuid.UUID, Role, error) {
+	claims := &accessClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.keyFunc)
 	if err != nil {
 		log.Printf("Error parsing token: %v", err)
-		return uuid.UUID{}, err
+		return uuid.UUID{}, "", err
 	}
 
 	id, err := token.Claims.GetSubject()
 	if err != nil {
 		log.Printf("Error getting user id: %v", err)
-		return uuid.UUID{}, err
+		return uuid.UUID{}, "", err
 	}
 
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, "", err
 	}
 	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
+		return uuid.Nil, "", errors.New("invalid issuer")
 	}
 
 	userId, err := uuid.Parse(id)
 	if err != nil {
 		log.Printf("Error parsing id string to uuid %v", err)
-		return uuid.UUID{}, err
+		return uuid.UUID{}, "", err
 	}
-	return userId, nil
+
+	role := claims.Role
+	if role == "" {
+		role = RoleUser
+	}
+	return userId, role, nil
 }
 
 func GetBearerToken(header http.Header) (string, error) {
@@ -98,7 +153,6 @@ func GetBearerToken(header http.Header) (string, error) {
 
 func GetAPIKey(header http.Header) (string, error) {
 	section := header.Get("Authorization")
-	log.Println(section)
 	split := strings.Split(section, " ")
 	if len(split) < 2 || split[0] != "ApiKey" {
 		return "", fmt.Errorf("Header doesn't contain api key")
@@ -107,6 +161,12 @@ func GetAPIKey(header http.Header) (string, error) {
 }
 
 func MakeRefreshToken() (string, error) {
+	return MakeOpaqueToken()
+}
+
+// MakeOpaqueToken returns 32 random bytes, hex encoded, for single-use bearer
+// tokens that are stored through HashToken.
+func MakeOpaqueToken() (string, error) {
 	bytes := make([]byte, 32)
 	_, err := rand.Read(bytes)
 	if err != nil {
@@ -116,3 +176,10 @@ func MakeRefreshToken() (string, error) {
 	token := hex.EncodeToString(bytes)
 	return token, nil
 }
+
+// HashToken returns the hex SHA-256 digest stored in place of an opaque
+// bearer token. Tokens are random, so an unsalted hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -65,33 +66,45 @@ func TestCheckPasswordHash(t *testing.T) {
 
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+	keys := NewHMACKeySet("secret")
+	validToken, _ := MakeJWT(userID, RoleUser, keys, time.Hour)
+	adminToken, _ := MakeJWT(userID, RoleAdmin, keys, time.Hour)
 
 	tests := []struct {
 		name        string
 		tokenString string
-		tokenSecret string
+		keys        *KeySet
 		wantUserID  uuid.UUID
+		wantRole    Role
 		wantErr     bool
 	}{
 		{
 			name:        "Valid token",
 			tokenString: validToken,
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserID:  userID,
+			wantRole:    RoleUser,
+			wantErr:     false,
+		},
+		{
+			name:        "Role claim",
+			tokenString: adminToken,
+			keys:        keys,
+			wantUserID:  userID,
+			wantRole:    RoleAdmin,
 			wantErr:     false,
 		},
 		{
 			name:        "Invalid token",
 			tokenString: "invalid.token.string",
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
 		{
 			name:        "Wrong secret",
 			tokenString: validToken,
-			tokenSecret: "wrong_secret",
+			keys:        NewHMACKeySet("wrong_secret"),
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
@@ -99,7 +112,7 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
+			gotUserID, gotRole, err := ValidateJWT(tt.tokenString, tt.keys)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -107,6 +120,30 @@ func TestValidateJWT(t *testing.T) {
 			if gotUserID != tt.wantUserID {
 				t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotUserID, tt.wantUserID)
 			}
+			if gotRole != tt.wantRole {
+				t.Errorf("ValidateJWT() gotRole = %v, want %v", gotRole, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestRoleAtLeast(t *testing.T) {
+	tests := []struct {
+		role Role
+		min  Role
+		want bool
+	}{
+		{role: RoleAdmin, min: RoleModerator, want: true},
+		{role: RoleModerator, min: RoleModerator, want: true},
+		{role: RoleUser, min: RoleModerator, want: false},
+		{role: Role("superuser"), min: RoleModerator, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role)+">="+string(tt.min), func(t *testing.T) {
+			if got := tt.role.AtLeast(tt.min); got != tt.want {
+				t.Errorf("AtLeast() = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
@@ -155,3 +192,34 @@ func TestGetBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestHashToken(t *testing.T) {
+	// Must match encode(sha256(convert_to(token, 'UTF8')), 'hex') used by the
+	// migration that hashed existing rows.
+	got := HashToken("abc")
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got != want {
+		t.Errorf("HashToken() = %v, want %v", got, want)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	hash, err := HashPassword(strings.Repeat("long password ", 4))
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	if NeedsRehash(hash) {
+		t.Error("NeedsRehash() = true for a hash with the configured cost")
+	}
+
+	defer SetPasswordCost(passwordCost)
+	if err := SetPasswordCost(passwordCost + 1); err != nil {
+		t.Fatal(err)
+	}
+	if !NeedsRehash(hash) {
+		t.Error("NeedsRehash() = false after the cost changed")
+	}
+	if err := SetPasswordCost(1); err == nil {
+		t.Error("SetPasswordCost() accepted a cost below the minimum")
+	}
+}
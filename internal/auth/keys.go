@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// legacyKeyID is used for the shared HS256 secret. Tokens signed with it carry
+// no kid header.
+const legacyKeyID = ""
+
+type jwtKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	signingKey interface{}
+	verifyKey  interface{}
+	// notAfter stops the key from verifying anything once passed. Zero means
+	// no cutoff.
+	notAfter time.Time
+}
+
+// KeySet holds every key accepted when validating access tokens and the one
+// key used to sign new tokens.
+type KeySet struct {
+	signingKID string
+	keys       map[string]*jwtKey
+}
+
+func NewHMACKeySet(secret string) *KeySet {
+	ks := &KeySet{keys: map[string]*jwtKey{}}
+	ks.AddHMAC(secret)
+	ks.signingKID = legacyKeyID
+	return ks
+}
+
+// AddHMAC accepts tokens signed with the shared secret.
+func (ks *KeySet) AddHMAC(secret string) {
+	ks.keys[legacyKeyID] = &jwtKey{
+		ID:         legacyKeyID,
+		Method:     jwt.SigningMethodHS256,
+		signingKey: []byte(secret),
+		verifyKey:  []byte(secret),
+	}
+}
+
+// AddLegacyHMAC accepts tokens signed with the shared secret until the given
+// time, so tokens issued before switching to asymmetric keys keep working
+// until they expire without trusting the secret forever.
+func (ks *KeySet) AddLegacyHMAC(secret string, until time.Time) {
+	ks.AddHMAC(secret)
+	ks.keys[legacyKeyID].notAfter = until
+}
+
+// LoadKeySet reads every *.pem file in dir. The file name without extension is
+// the kid. Private keys can sign and verify, public keys only verify, which is
+// how a retired key stays valid until its tokens expire. New tokens are signed
+// with activeKID, or with the last private key by name when it is empty.
+func LoadKeySet(dir, activeKID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	ks := &KeySet{keys: map[string]*jwtKey{}}
+	lastPrivate := ""
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := loadPEMKey(path, kid)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		ks.keys[kid] = key
+		if key.signingKey != nil {
+			lastPrivate = kid
+		}
+	}
+
+	if activeKID == "" {
+		activeKID = lastPrivate
+	}
+	key, ok := ks.keys[activeKID]
+	if !ok || key.signingKey == nil {
+		return nil, fmt.Errorf("no private signing key %q in %s", activeKID, dir)
+	}
+	ks.signingKID = activeKID
+	return ks, nil
+}
+
+func loadPEMKey(path, kid string) (*jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &jwtKey{ID: kid, Method: jwt.SigningMethodRS256, signingKey: k, verifyKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &jwtKey{ID: kid, Method: jwt.SigningMethodRS256, verifyKey: k}, nil
+	case ed25519.PrivateKey:
+		return &jwtKey{ID: kid, Method: jwt.SigningMethodEdDSA, signingKey: k, verifyKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &jwtKey{ID: kid, Method: jwt.SigningMethodEdDSA, verifyKey: k}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", parsed)
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	key := ks.keys[ks.signingKID]
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != legacyKeyID {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.signingKey)
+}
+
+func (ks *KeySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", t.Method.Alg(), kid)
+	}
+	if !key.notAfter.IsZero() && time.Now().After(key.notAfter) {
+		return nil, fmt.Errorf("signing key %q is no longer accepted", kid)
+	}
+	return key.verifyKey, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public verification keys. The shared HS256 secret is never
+// published.
+func (ks *KeySet) JWKS() JWKS {
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := JWKS{Keys: []JWK{}}
+	for _, kid := range kids {
+		key := ks.keys[kid]
+		jwk := JWK{Kid: kid, Use: "sig", Alg: key.Method.Alg()}
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
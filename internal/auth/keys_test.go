@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestKeys(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, "2024-01-rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, "2024-06-ed25519.pem", "PRIVATE KEY", der)
+	return dir
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := writeTestKeys(t)
+
+	tests := []struct {
+		name      string
+		activeKID string
+		wantKID   string
+		wantAlg   string
+		wantErr   bool
+	}{
+		{
+			name:    "Defaults to last private key",
+			wantKID: "2024-06-ed25519",
+			wantAlg: "EdDSA",
+		},
+		{
+			name:      "Explicit signing key",
+			activeKID: "2024-01-rsa",
+			wantKID:   "2024-01-rsa",
+			wantAlg:   "RS256",
+		},
+		{
+			name:      "Unknown signing key",
+			activeKID: "missing",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := LoadKeySet(dir, tt.activeKID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadKeySet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			userID := uuid.New()
+			tokenString, err := MakeJWT(userID, RoleUser, keys, time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT() error = %v", err)
+			}
+			token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Header["kid"] != tt.wantKID || token.Method.Alg() != tt.wantAlg {
+				t.Errorf("header = %v, want kid %v alg %v", token.Header, tt.wantKID, tt.wantAlg)
+			}
+
+			gotUserID, _, err := ValidateJWT(tokenString, keys)
+			if err != nil || gotUserID != userID {
+				t.Errorf("ValidateJWT() = %v, %v, want %v", gotUserID, err, userID)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := writeTestKeys(t)
+	oldKeys, err := LoadKeySet(dir, "2024-01-rsa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, _ := MakeJWT(uuid.New(), RoleUser, oldKeys, time.Hour)
+
+	// Retire the RSA key: only its public half stays in the directory.
+	rsaPEM, _ := os.ReadFile(filepath.Join(dir, "2024-01-rsa.pem"))
+	block, _ := pem.Decode(rsaPEM)
+	rsaKey, _ := x509.ParsePKCS1PrivateKey(block.Bytes)
+	pubDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	writePEM(t, dir, "2024-01-rsa.pem", "PUBLIC KEY", pubDER)
+
+	newKeys, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ValidateJWT(oldToken, newKeys); err != nil {
+		t.Errorf("token signed with retired key rejected: %v", err)
+	}
+	if _, err := LoadKeySet(dir, "2024-01-rsa"); err == nil {
+		t.Error("LoadKeySet() accepted a public key for signing")
+	}
+}
+
+func TestValidateJWTRejectsAlgorithmConfusion(t *testing.T) {
+	dir := writeTestKeys(t)
+	keys, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.AddHMAC("secret")
+
+	// An HS256 token claiming the Ed25519 kid must not verify.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeAccess),
+		Subject:   uuid.New().String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	token.Header["kid"] = "2024-06-ed25519"
+	forged, _ := token.SignedString([]byte("secret"))
+	if _, _, err := ValidateJWT(forged, keys); err == nil {
+		t.Error("ValidateJWT() accepted HS256 token for an EdDSA kid")
+	}
+
+	legacy, _ := MakeJWT(uuid.New(), RoleUser, NewHMACKeySet("secret"), time.Hour)
+	if _, _, err := ValidateJWT(legacy, keys); err != nil {
+		t.Errorf("legacy HS256 token rejected: %v", err)
+	}
+}
+
+func TestAddLegacyHMACCutoff(t *testing.T) {
+	dir := writeTestKeys(t)
+	legacy, _ := MakeJWT(uuid.New(), RoleUser, NewHMACKeySet("secret"), time.Hour)
+
+	tests := []struct {
+		name    string
+		until   time.Time
+		wantErr bool
+	}{
+		{name: "Before cutoff", until: time.Now().Add(time.Minute)},
+		{name: "After cutoff", until: time.Now().Add(-time.Minute), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := LoadKeySet(dir, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys.AddLegacyHMAC("secret", tt.until)
+
+			_, _, err = ValidateJWT(legacy, keys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keys, err := LoadKeySet(writeTestKeys(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.AddHMAC("secret")
+
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS() returned %d keys, want 2", len(set.Keys))
+	}
+	rsaKey, edKey := set.Keys[0], set.Keys[1]
+	if rsaKey.Kid != "2024-01-rsa" || rsaKey.Kty != "RSA" || rsaKey.Alg != "RS256" || rsaKey.N == "" || rsaKey.E != "AQAB" {
+		t.Errorf("unexpected RSA JWK %+v", rsaKey)
+	}
+	if edKey.Kid != "2024-06-ed25519" || edKey.Kty != "OKP" || edKey.Crv != "Ed25519" || edKey.X == "" {
+		t.Errorf("unexpected Ed25519 JWK %+v", edKey)
+	}
+}
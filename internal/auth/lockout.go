@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// CheckPasswordMissingUser does the same bcrypt work as CheckPasswordHash so a
+// login for an unknown email takes as long as one with a wrong password.
+func CheckPasswordMissingUser(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("chirpy-missing-user"), passwordCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// LockoutDuration returns how long to lock logins after the given number of
+// consecutive failures. Nothing happens below threshold, then the lockout
+// starts at base and doubles with every further failure, up to max.
+func LockoutDuration(failures, threshold int, base, max time.Duration) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	d := base
+	for i := threshold; i < failures; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+	return d
+}
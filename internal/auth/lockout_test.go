@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{
+			name:     "Below threshold",
+			failures: 4,
+			want:     0,
+		},
+		{
+			name:     "At threshold",
+			failures: 5,
+			want:     30 * time.Second,
+		},
+		{
+			name:     "Doubles per failure",
+			failures: 7,
+			want:     2 * time.Minute,
+		},
+		{
+			name:     "Capped",
+			failures: 50,
+			want:     15 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := LockoutDuration(tt.failures, 5, 30*time.Second, 15*time.Minute)
+			if got != tt.want {
+				t.Errorf("LockoutDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	err := os.WriteFile(path, []byte("password123\n\nCorrectHorseBattery\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPasswordPolicy(10, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{
+			name:     "Acceptable password",
+			password: "a long unique passphrase",
+			wantErr:  false,
+		},
+		{
+			name:     "Too short",
+			password: "short",
+			wantErr:  true,
+		},
+		{
+			name:     "Multibyte characters count once",
+			password: "ééééééééééé",
+			wantErr:  false,
+		},
+		{
+			name:     "Too long for bcrypt",
+			password: strings.Repeat("a", 73),
+			wantErr:  true,
+		},
+		{
+			name:     "Breached password",
+			password: "password123",
+			wantErr:  true,
+		},
+		{
+			name:     "Breached password in other case",
+			password: "correcthorsebattery",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+type emailVerificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// MakeEmailVerificationToken signs a token proving control of email. It is
+// single use because verifying only succeeds while the user's address is
+// still email and not yet verified.
+func MakeEmailVerificationToken(userID uuid.UUID, email string, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return keys.sign(emailVerificationClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeEmailVerification),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+	})
+}
+
+func ValidateEmailVerificationToken(tokenString string, keys *KeySet) (uuid.UUID, string, error) {
+	claims := &emailVerificationClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, keys.keyFunc, jwt.WithIssuer(string(TokenTypeEmailVerification)))
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	if claims.Email == "" {
+		return uuid.Nil, "", errors.New("token has no email")
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	return userID, claims.Email, nil
+}
+
+// MakeMFAChallengeToken proves the password step of a login succeeded. It is
+// exchanged together with a second factor for real tokens.
+func MakeMFAChallengeToken(userID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return keys.sign(jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeMFAChallenge),
+		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+		Subject:   userID.String(),
+	})
+}
+
+func ValidateMFAChallengeToken(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, keys.keyFunc, jwt.WithIssuer(string(TokenTypeMFAChallenge)))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(claims.Subject)
+}
+
+// MakeReauthToken proves the user just signed in again with their identity
+// provider. Accounts without a known password use it to confirm sensitive
+// actions.
+func MakeReauthToken(userID uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return keys.sign(jwt.RegisteredClaims{
+		Issuer:    string(TokenTypeReauth),
+		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+		Subject:   userID.String(),
+	})
+}
+
+func ValidateReauthToken(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, keys.keyFunc, jwt.WithIssuer(string(TokenTypeReauth)))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(claims.Subject)
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestValidateEmailVerificationToken(t *testing.T) {
+	keys := NewHMACKeySet("secret")
+	userID := uuid.New()
+	validToken, _ := MakeEmailVerificationToken(userID, "user@example.com", keys, time.Hour)
+	expiredToken, _ := MakeEmailVerificationToken(userID, "user@example.com", keys, -time.Hour)
+	accessToken, _ := MakeJWT(userID, RoleUser, keys, time.Hour)
+
+	tests := []struct {
+		name        string
+		tokenString string
+		wantUserID  uuid.UUID
+		wantEmail   string
+		wantErr     bool
+	}{
+		{
+			name:        "Valid token",
+			tokenString: validToken,
+			wantUserID:  userID,
+			wantEmail:   "user@example.com",
+		},
+		{
+			name:        "Expired token",
+			tokenString: expiredToken,
+			wantErr:     true,
+		},
+		{
+			name:        "Access token",
+			tokenString: accessToken,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUserID, gotEmail, err := ValidateEmailVerificationToken(tt.tokenString, keys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateEmailVerificationToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotUserID != tt.wantUserID || gotEmail != tt.wantEmail {
+				t.Errorf("ValidateEmailVerificationToken() = %v, %v, want %v, %v", gotUserID, gotEmail, tt.wantUserID, tt.wantEmail)
+			}
+		})
+	}
+
+	// A verification token must not pass as an access token.
+	if _, _, err := ValidateJWT(validToken, keys); err == nil {
+		t.Error("ValidateJWT() accepted an email verification token")
+	}
+}
+
+func TestValidateMFAChallengeToken(t *testing.T) {
+	keys := NewHMACKeySet("secret")
+	userID := uuid.New()
+	challenge, _ := MakeMFAChallengeToken(userID, keys, time.Minute)
+
+	got, err := ValidateMFAChallengeToken(challenge, keys)
+	if err != nil || got != userID {
+		t.Errorf("ValidateMFAChallengeToken() = %v, %v, want %v", got, err, userID)
+	}
+	if _, _, err := ValidateJWT(challenge, keys); err == nil {
+		t.Error("ValidateJWT() accepted an MFA challenge token")
+	}
+
+	accessToken, _ := MakeJWT(userID, RoleUser, keys, time.Hour)
+	if _, err := ValidateMFAChallengeToken(accessToken, keys); err == nil {
+		t.Error("ValidateMFAChallengeToken() accepted an access token")
+	}
+}
+
+func TestValidateReauthToken(t *testing.T) {
+	keys := NewHMACKeySet("secret")
+	userID := uuid.New()
+	reauth, _ := MakeReauthToken(userID, keys, time.Minute)
+
+	got, err := ValidateReauthToken(reauth, keys)
+	if err != nil || got != userID {
+		t.Errorf("ValidateReauthToken() = %v, %v, want %v", got, err, userID)
+	}
+	if _, _, err := ValidateJWT(reauth, keys); err == nil {
+		t.Error("ValidateJWT() accepted a reauth token")
+	}
+
+	challenge, _ := MakeMFAChallengeToken(userID, keys, time.Minute)
+	if _, err := ValidateReauthToken(challenge, keys); err == nil {
+		t.Error("ValidateReauthToken() accepted an MFA challenge token")
+	}
+}
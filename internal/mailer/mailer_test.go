@@ -0,0 +1,93 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     Message
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "Plain message",
+			msg:  Message{To: "user@example.com", Subject: "Hello", Body: "line one\nline two"},
+			want: []string{"To: user@example.com\r\n", "Subject: Hello\r\n", "\r\n\r\nline one\r\nline two\r\n"},
+		},
+		{
+			name:    "Header injection",
+			msg:     Message{To: "user@example.com\r\nBcc: other@example.com", Subject: "Hello"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format("chirpy@example.com", tt.msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Format() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, part := range tt.want {
+				if !strings.Contains(string(got), part) {
+					t.Errorf("Format() = %q, missing %q", got, part)
+				}
+			}
+		})
+	}
+}
+
+func TestFileMailerAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.txt")
+	m := NewFileMailer(path, "chirpy@example.com")
+	for _, subject := range []string{"First", "Second"} {
+		err := m.Send(context.Background(), Message{To: "user@example.com", Subject: subject, Body: "hi"})
+		if err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Subject: First") || !strings.Contains(string(data), "Subject: Second") {
+		t.Errorf("mail file = %q, want both messages", data)
+	}
+}
+
+func TestSMTPMailerSendHonoursContext(t *testing.T) {
+	// The server accepts the connection but never sends its greeting.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	m := NewSMTPMailer(ln.Addr().String(), "chirpy@example.com", "", "")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = m.Send(ctx, Message{To: "user@example.com", Subject: "Hello"})
+	if err == nil {
+		t.Fatal("Send() error = nil, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send() took %v, want it bounded by the context", elapsed)
+	}
+}
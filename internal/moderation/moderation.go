@@ -0,0 +1,171 @@
+package moderation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+type Action string
+
+const (
+	ActionMask   Action = "mask"
+	ActionReject Action = "reject"
+	ActionFlag   Action = "flag"
+)
+
+const mask = "****"
+
+func ParseAction(s string) (Action, error) {
+	switch Action(strings.ToLower(s)) {
+	case ActionMask:
+		return ActionMask, nil
+	case ActionReject:
+		return ActionReject, nil
+	case ActionFlag:
+		return ActionFlag, nil
+	}
+	return "", fmt.Errorf("unknown moderation action %q", s)
+}
+
+type Rule struct {
+	Word   string
+	Action Action
+}
+
+type Result struct {
+	Body     string
+	Rejected bool
+	Flagged  []string
+}
+
+type Filter interface {
+	Apply(body string) Result
+}
+
+// WordFilter matches whole words case-insensitively. Rules can be swapped at
+// runtime while requests are being filtered.
+type WordFilter struct {
+	mu    sync.RWMutex
+	rules map[string]Action
+}
+
+func NewWordFilter(rules []Rule) *WordFilter {
+	f := &WordFilter{}
+	f.SetRules(rules)
+	return f
+}
+
+func (f *WordFilter) SetRules(rules []Rule) {
+	byWord := make(map[string]Action, len(rules))
+	for _, rule := range rules {
+		byWord[normalize(rule.Word)] = rule.Action
+	}
+	f.mu.Lock()
+	f.rules = byWord
+	f.mu.Unlock()
+}
+
+func (f *WordFilter) Rules() []Rule {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	rules := make([]Rule, 0, len(f.rules))
+	for word, action := range f.rules {
+		rules = append(rules, Rule{Word: word, Action: action})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Word < rules[j].Word })
+	return rules
+}
+
+func (f *WordFilter) Apply(body string) Result {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	result := Result{}
+	var out strings.Builder
+	for _, tok := range tokenize(body) {
+		if !tok.word {
+			out.WriteString(tok.text)
+			continue
+		}
+		switch f.rules[normalize(tok.text)] {
+		case ActionMask:
+			out.WriteString(mask)
+		case ActionReject:
+			result.Rejected = true
+			out.WriteString(tok.text)
+		case ActionFlag:
+			result.Flagged = append(result.Flagged, normalize(tok.text))
+			out.WriteString(tok.text)
+		default:
+			out.WriteString(tok.text)
+		}
+	}
+	result.Body = out.String()
+	return result
+}
+
+// LoadRulesFile reads one rule per line in the form "word [action]". Blank
+// lines and lines starting with # are skipped; the action defaults to mask.
+func LoadRulesFile(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := []Rule{}
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		rule := Rule{Word: fields[0], Action: ActionMask}
+		if len(fields) > 1 {
+			rule.Action, err = ParseAction(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+type token struct {
+	text string
+	word bool
+}
+
+// tokenize splits s into runs of letters/digits and runs of everything else,
+// so punctuation never hides a word and joining the tokens gives back s.
+func tokenize(s string) []token {
+	tokens := []token{}
+	start := 0
+	inWord := false
+	for i, r := range s {
+		isWordRune := unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.Is(unicode.Mn, r)
+		if i > 0 && isWordRune != inWord {
+			tokens = append(tokens, token{text: s[start:i], word: inWord})
+			start = i
+		}
+		inWord = isWordRune
+	}
+	if start < len(s) {
+		tokens = append(tokens, token{text: s[start:], word: inWord})
+	}
+	return tokens
+}
+
+func normalize(word string) string {
+	return strings.ToLower(word)
+}
@@ -0,0 +1,100 @@
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWordFilterApply(t *testing.T) {
+	filter := NewWordFilter([]Rule{
+		{Word: "kerfuffle", Action: ActionMask},
+		{Word: "Spam", Action: ActionReject},
+		{Word: "sketchy", Action: ActionFlag},
+	})
+
+	tests := []struct {
+		name         string
+		body         string
+		wantBody     string
+		wantRejected bool
+		wantFlagged  []string
+	}{
+		{
+			name:     "Clean body",
+			body:     "Hello there",
+			wantBody: "Hello there",
+		},
+		{
+			name:     "Masked word with punctuation",
+			body:     "What a Kerfuffle!",
+			wantBody: "What a ****!",
+		},
+		{
+			name:     "Word inside another word is kept",
+			body:     "kerfuffles everywhere",
+			wantBody: "kerfuffles everywhere",
+		},
+		{
+			name:         "Rejected word",
+			body:         "buy SPAM now",
+			wantBody:     "buy SPAM now",
+			wantRejected: true,
+		},
+		{
+			name:        "Flagged word",
+			body:        "that looks sketchy...",
+			wantBody:    "that looks sketchy...",
+			wantFlagged: []string{"sketchy"},
+		},
+		{
+			name:     "Unicode punctuation",
+			body:     "«kerfuffle» ¡ok!",
+			wantBody: "«****» ¡ok!",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filter.Apply(tt.body)
+			if got.Body != tt.wantBody {
+				t.Errorf("Apply() body = %q, want %q", got.Body, tt.wantBody)
+			}
+			if got.Rejected != tt.wantRejected {
+				t.Errorf("Apply() rejected = %v, want %v", got.Rejected, tt.wantRejected)
+			}
+			if !reflect.DeepEqual(got.Flagged, tt.wantFlagged) {
+				t.Errorf("Apply() flagged = %v, want %v", got.Flagged, tt.wantFlagged)
+			}
+		})
+	}
+}
+
+func TestLoadRulesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	content := "# banned words\nkerfuffle\nspam reject\n\nsketchy flag\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := LoadRulesFile(path)
+	if err != nil {
+		t.Fatalf("LoadRulesFile() error = %v", err)
+	}
+	want := []Rule{
+		{Word: "kerfuffle", Action: ActionMask},
+		{Word: "spam", Action: ActionReject},
+		{Word: "sketchy", Action: ActionFlag},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("LoadRulesFile() = %v, want %v", rules, want)
+	}
+
+	if err := os.WriteFile(path, []byte("spam delete\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRulesFile(path); err == nil {
+		t.Errorf("LoadRulesFile() expected error for unknown action")
+	}
+}
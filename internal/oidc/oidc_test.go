@@ -0,0 +1,169 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockProvider is a minimal OIDC provider that issues one authorization code
+// per call to authorize.
+type mockProvider struct {
+	t        *testing.T
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+	codes    map[string]mockGrant
+	audience string
+}
+
+type mockGrant struct {
+	challenge string
+	nonce     string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{t: t, key: key, clientID: "chirpy", codes: map[string]mockGrant{}}
+	m.audience = m.clientID
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock-1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		grant, ok := m.codes[r.Form.Get("code")]
+		delete(m.codes, r.Form.Get("code"))
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge || r.Form.Get("client_id") != m.clientID {
+			w.WriteHeader(400)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.idToken(grant.nonce)})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// authorize stands in for the user approving the login in a browser.
+func (m *mockProvider) authorize(authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != m.clientID {
+		m.t.Fatalf("unexpected authorization request %v", authURL)
+	}
+	code := "code-" + q.Get("state")
+	m.codes[code] = mockGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	return code
+}
+
+func (m *mockProvider) idToken(nonce string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, idTokenClaims{
+		Nonce:         nonce,
+		Email:         "user@example.com",
+		EmailVerified: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.server.URL,
+			Subject:   "subject-123",
+			Audience:  jwt.ClaimStrings{m.audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	token.Header["kid"] = "mock-1"
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return signed
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	tests := []struct {
+		name          string
+		wrongPKCE     bool
+		wrongNonce    bool
+		wrongAudience bool
+		wantErr       bool
+	}{
+		{name: "Successful login"},
+		{name: "Wrong code verifier", wrongPKCE: true, wantErr: true},
+		{name: "Nonce mismatch", wrongNonce: true, wantErr: true},
+		{name: "Token for another client", wrongAudience: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := newMockProvider(t)
+			if tt.wrongAudience {
+				mock.audience = "someone-else"
+			}
+			provider := NewProvider(Config{
+				Issuer:      mock.server.URL,
+				ClientID:    "chirpy",
+				RedirectURL: "http://localhost:8080/api/auth/oidc/callback",
+			}, mock.server.Client())
+			ctx := context.Background()
+
+			verifier, challenge, err := NewPKCEVerifier()
+			if err != nil {
+				t.Fatal(err)
+			}
+			state, _ := RandomValue()
+			nonce, _ := RandomValue()
+			authURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+			if err != nil {
+				t.Fatalf("AuthCodeURL() error = %v", err)
+			}
+			code := mock.authorize(authURL)
+
+			if tt.wrongPKCE {
+				verifier, _, _ = NewPKCEVerifier()
+			}
+			if tt.wrongNonce {
+				nonce = "other"
+			}
+			claims, err := provider.Exchange(ctx, code, verifier, nonce)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Exchange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (claims.Subject != "subject-123" || claims.Email != "user@example.com" || !claims.EmailVerified) {
+				t.Errorf("Exchange() = %+v", claims)
+			}
+		})
+	}
+}
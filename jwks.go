@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mikarwacki/chirpy/internal/auth"
+)
+
+// loadJWTKeys signs with the keys in keyDir when it is set. JWT_SECRET is
+// then only accepted for verification until legacyUntil (RFC 3339), which must
+// be a fixed time so restarts don't reopen the window; set it to when the last
+// token signed with the secret expires. Keys are read once at startup, so
+// rotating them takes a restart.
+func loadJWTKeys(secret, keyDir, signingKid, legacyUntil string) (*auth.KeySet, error) {
+	if keyDir == "" {
+		return auth.NewHMACKeySet(secret), nil
+	}
+	keys, err := auth.LoadKeySet(keyDir, signingKid)
+	if err != nil {
+		return nil, err
+	}
+	if secret != "" {
+		if legacyUntil == "" {
+			return nil, errors.New("JWT_LEGACY_ACCEPT_UNTIL is required while JWT_SECRET is set alongside JWT_KEY_DIR")
+		}
+		until, err := time.Parse(time.RFC3339, legacyUntil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_LEGACY_ACCEPT_UNTIL: %w", err)
+		}
+		keys.AddLegacyHMAC(secret, until)
+	}
+	return keys, nil
+}
+
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJson(w, 200, cfg.jwtKeys.JWKS())
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadJWTKeysLegacyCutoff(t *testing.T) {
+	dir := t.TempDir()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, "2025-01-ed.pem"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		secret      string
+		legacyUntil string
+		wantErr     bool
+	}{
+		{name: "no legacy secret", wantErr: false},
+		{name: "secret with cutoff", secret: "secret", legacyUntil: "2026-01-01T00:00:00Z", wantErr: false},
+		{name: "secret without cutoff", secret: "secret", wantErr: true},
+		{name: "invalid cutoff", secret: "secret", legacyUntil: "tomorrow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadJWTKeys(tt.secret, dir, "", tt.legacyUntil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadJWTKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handlerLikeChirp(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+
+	err = cfg.db.LikeChirp(r.Context(), database.LikeChirpParams{ChirpID: chirpId, UserID: userId})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, 409, "Chirp already liked", err)
+			return
+		}
+		if isForeignKeyViolation(err) {
+			respondWithError(w, 404, "Chirp doesn't exist", err)
+			return
+		}
+		respondWithError(w, 400, "Error liking chirp", err)
+		return
+	}
+	respondWithJson(w, 204, nil)
+}
+
+func (cfg *apiConfig) handlerUnlikeChirp(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+
+	err = cfg.db.UnlikeChirp(r.Context(), database.UnlikeChirpParams{ChirpID: chirpId, UserID: userId})
+	if err != nil {
+		respondWithError(w, 400, "Error unliking chirp", err)
+		return
+	}
+	respondWithJson(w, 204, nil)
+}
+
+// attachChirpStats fills like and reply counts for a batch of chirps with one
+// aggregate query each, rather than a query per chirp.
+func (cfg *apiConfig) attachChirpStats(ctx context.Context, chirps []responseChirp, viewerId uuid.NullUUID) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(chirps))
+	for i, chr := range chirps {
+		ids[i] = chr.ID
+	}
+
+	likeStats, err := cfg.db.GetChirpLikeStats(ctx, database.GetChirpLikeStatsParams{ViewerID: viewerId, ChirpIds: ids})
+	if err != nil {
+		return err
+	}
+	replyCounts, err := cfg.db.GetChirpReplyCounts(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	likesByChirp := make(map[uuid.UUID]database.GetChirpLikeStatsRow, len(likeStats))
+	for _, st := range likeStats {
+		likesByChirp[st.ChirpID] = st
+	}
+	repliesByChirp := make(map[uuid.UUID]int64, len(replyCounts))
+	for _, rc := range replyCounts {
+		repliesByChirp[rc.ParentID.UUID] = rc.ReplyCount
+	}
+	for i := range chirps {
+		st := likesByChirp[chirps[i].ID]
+		chirps[i].LikeCount = st.LikeCount
+		chirps[i].LikedByMe = st.LikedByMe
+		chirps[i].ReplyCount = repliesByChirp[chirps[i].ID]
+	}
+	return nil
+}
+
+func viewerIdFromContext(ctx context.Context) uuid.NullUUID {
+	userId, ok := ctx.Value("userId").(uuid.UUID)
+	return uuid.NullUUID{UUID: userId, Valid: ok}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikarwacki/chirpy/internal/auth"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+const (
+	accountLockoutThreshold = 5
+	ipLockoutThreshold      = 20
+	lockoutBase             = 30 * time.Second
+	lockoutMax              = 15 * time.Minute
+	// Failures older than this no longer count towards a lockout.
+	loginFailureWindow = time.Hour
+)
+
+type loginKey struct {
+	key       string
+	threshold int
+}
+
+// loginKeys returns the counters a login attempt is tracked under: the
+// account, whether or not it exists, and the client address.
+func (cfg *apiConfig) loginKeys(r *http.Request, email string) []loginKey {
+	return []loginKey{
+		{key: accountLoginKey(email), threshold: accountLockoutThreshold},
+		{key: "ip:" + cfg.clientIP(r), threshold: ipLockoutThreshold},
+	}
+}
+
+func accountLoginKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+// loginLockedUntil returns the latest lockout among keys, or the zero time when
+// none is locked.
+func (cfg *apiConfig) loginLockedUntil(ctx context.Context, keys []loginKey) (time.Time, error) {
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, k.key)
+	}
+	lockouts, err := cfg.db.GetLoginLockouts(ctx, names)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return latestLockout(lockouts), nil
+}
+
+func latestLockout(lockouts []database.LoginAttempt) time.Time {
+	var until time.Time
+	for _, l := range lockouts {
+		if l.LockedUntil.Valid && l.LockedUntil.Time.After(until) {
+			until = l.LockedUntil.Time
+		}
+	}
+	return until
+}
+
+func (cfg *apiConfig) recordFailedLogin(ctx context.Context, keys []loginKey) {
+	for _, k := range keys {
+		attempt, err := cfg.db.RecordFailedLogin(ctx, database.RecordFailedLoginParams{
+			Key:         k.key,
+			WindowStart: time.Now().Add(-loginFailureWindow),
+		})
+		if err != nil {
+			log.Printf("Error recording failed login for %v: %v", k.key, err)
+			continue
+		}
+
+		lockout := auth.LockoutDuration(int(attempt.FailedCount), k.threshold, lockoutBase, lockoutMax)
+		if lockout == 0 {
+			continue
+		}
+		log.Printf("Locking logins for %v for %v after %d failures", k.key, lockout, attempt.FailedCount)
+		err = cfg.db.LockLogin(ctx, database.LockLoginParams{
+			Key:         k.key,
+			LockedUntil: sql.NullTime{Time: time.Now().Add(lockout), Valid: true},
+		})
+		if err != nil {
+			log.Printf("Error locking logins for %v: %v", k.key, err)
+		}
+	}
+}
+
+func respondLoginLocked(w http.ResponseWriter, until time.Time) {
+	respondRateLimited(w, until, "Too many failed login attempts, try again later")
+}
+
+func respondRateLimited(w http.ResponseWriter, until time.Time, msg string) {
+	retryAfter := int(time.Until(until).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	respondWithError(w, 429, msg, nil)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+func TestLatestLockout(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		lockouts []database.LoginAttempt
+		want     time.Time
+	}{
+		{name: "no lockouts"},
+		{name: "counter without lockout", lockouts: []database.LoginAttempt{{Key: "ip:192.0.2.1", FailedCount: 2}}},
+		{
+			name: "latest of several",
+			lockouts: []database.LoginAttempt{
+				{Key: "account:bob@example.com", LockedUntil: sql.NullTime{Time: now.Add(time.Minute), Valid: true}},
+				{Key: "ip:192.0.2.1", LockedUntil: sql.NullTime{Time: now.Add(time.Hour), Valid: true}},
+			},
+			want: now.Add(time.Hour),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latestLockout(tt.lockouts); !got.Equal(tt.want) {
+				t.Errorf("latestLockout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
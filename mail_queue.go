@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// mailSendTimeout bounds a single queued job so a hung mail server can't tie
+// up a worker for good.
+const mailSendTimeout = 30 * time.Second
+
+// mailQueue runs mail jobs on a fixed number of workers, so a burst of
+// requests can't start an unbounded number of goroutines or SMTP connections.
+type mailQueue struct {
+	jobs chan func(ctx context.Context)
+}
+
+func newMailQueue(workers, size int) *mailQueue {
+	q := &mailQueue{jobs: make(chan func(ctx context.Context), size)}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+func (q *mailQueue) work() {
+	for job := range q.jobs {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		job(ctx)
+		cancel()
+	}
+}
+
+// enqueue schedules job without blocking and reports false when the queue is
+// full and the job was dropped.
+func (q *mailQueue) enqueue(job func(ctx context.Context)) bool {
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMailQueue(t *testing.T) {
+	q := newMailQueue(0, 1)
+	if !q.enqueue(func(ctx context.Context) {}) {
+		t.Fatal("enqueue() rejected a job with room in the queue")
+	}
+	if q.enqueue(func(ctx context.Context) {}) {
+		t.Error("enqueue() accepted a job into a full queue")
+	}
+
+	done := make(chan bool)
+	q = newMailQueue(1, 1)
+	q.enqueue(func(ctx context.Context) {
+		_, hasDeadline := ctx.Deadline()
+		done <- hasDeadline
+	})
+	select {
+	case hasDeadline := <-done:
+		if !hasDeadline {
+			t.Error("job context has no deadline")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("worker didn't run the job")
+	}
+}
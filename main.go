@@ -6,20 +6,39 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
+	"strconv"
 	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/mikarwacki/chirpy/internal/auth"
 	"github.com/mikarwacki/chirpy/internal/database"
+	"github.com/mikarwacki/chirpy/internal/mailer"
+	"github.com/mikarwacki/chirpy/internal/moderation"
+	"github.com/mikarwacki/chirpy/internal/oidc"
 )
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	db             *database.Queries
-	jwtSecret      string
-	polkaApiKey    string
+	fileserverHits      atomic.Int32
+	db                  *database.Queries
+	conn                *sql.DB
+	jwtKeys             *auth.KeySet
+	passwordPolicy      *auth.PasswordPolicy
+	mailer              mailer.Mailer
+	mailQueue           *mailQueue
+	oidc                *oidc.Provider
+	oidcProvider        string
+	polkaApiKey         string
+	moderation          *moderation.WordFilter
+	moderationRulesFile string
+	platform            string
+	adminEmails         []string
+	trustedProxies      []netip.Prefix
+	fixturesFile        string
 }
 
 func main() {
@@ -31,6 +50,41 @@ func main() {
 	dbUrl := os.Getenv("DB_URL")
 	jwtSecret := os.Getenv("JWT_SECRET")
 	polkaApiKey := os.Getenv("POLKA_API_KEY")
+	moderationRulesFile := os.Getenv("MODERATION_RULES_FILE")
+	platform := os.Getenv("PLATFORM")
+	fixturesFile := os.Getenv("FIXTURES_FILE")
+	adminEmails := parseAdminEmails(os.Getenv("ADMIN_EMAILS"))
+
+	trustedProxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	jwtKeys, err := loadJWTKeys(jwtSecret, os.Getenv("JWT_KEY_DIR"), os.Getenv("JWT_SIGNING_KID"), os.Getenv("JWT_LEGACY_ACCEPT_UNTIL"))
+	if err != nil {
+		log.Fatalf("couldn't load jwt keys: %v", err)
+	}
+
+	if cost := os.Getenv("BCRYPT_COST"); cost != "" {
+		n, err := strconv.Atoi(cost)
+		if err == nil {
+			err = auth.SetPasswordCost(n)
+		}
+		if err != nil {
+			log.Fatalf("invalid BCRYPT_COST: %v", err)
+		}
+	}
+	minPasswordLength := 8
+	if length := os.Getenv("PASSWORD_MIN_LENGTH"); length != "" {
+		minPasswordLength, err = strconv.Atoi(length)
+		if err != nil {
+			log.Fatalf("invalid PASSWORD_MIN_LENGTH: %v", err)
+		}
+	}
+	passwordPolicy, err := auth.LoadPasswordPolicy(minPasswordLength, os.Getenv("BREACHED_PASSWORDS_FILE"))
+	if err != nil {
+		log.Fatalf("couldn't load password policy: %v", err)
+	}
 
 	log.Printf("Connecting to db with url: %v\n", dbUrl)
 	db, err := sql.Open("postgres", dbUrl)
@@ -40,28 +94,105 @@ func main() {
 	dbQueries := database.New(db)
 
 	apiCfg := apiConfig{
-		fileserverHits: atomic.Int32{},
-		db:             dbQueries,
-		jwtSecret:      jwtSecret,
-		polkaApiKey:    polkaApiKey,
+		fileserverHits:      atomic.Int32{},
+		db:                  dbQueries,
+		conn:                db,
+		jwtKeys:             jwtKeys,
+		passwordPolicy:      passwordPolicy,
+		mailer:              newMailer(),
+		mailQueue:           newMailQueue(4, 100),
+		polkaApiKey:         polkaApiKey,
+		moderation:          moderation.NewWordFilter(nil),
+		moderationRulesFile: moderationRulesFile,
+		platform:            platform,
+		fixturesFile:        fixturesFile,
+		adminEmails:         adminEmails,
+		trustedProxies:      trustedProxies,
+	}
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		apiCfg.oidc = oidc.NewProvider(oidc.Config{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		}, nil)
+		apiCfg.oidcProvider = os.Getenv("OIDC_PROVIDER_NAME")
+		if apiCfg.oidcProvider == "" {
+			apiCfg.oidcProvider = issuer
+		}
+	}
+	err = apiCfg.bootstrapAdmins(context.Background())
+	if err != nil {
+		log.Printf("couldn't promote ADMIN_EMAILS: %v", err)
+	}
+	err = apiCfg.reloadModerationRules(context.Background())
+	if err != nil {
+		log.Printf("couldn't load moderation rules: %v", err)
 	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))))
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handlerJWKS)
+	mux.HandleFunc("GET /admin/metrics", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerMetrics))
+	mux.HandleFunc("POST /admin/reset", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerReset))
+	mux.HandleFunc("PUT /admin/users/{id}/role", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerSetUserRole))
+	mux.HandleFunc("GET /admin/moderation/rules", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerGetModerationRules))
+	mux.HandleFunc("PUT /admin/moderation/rules/{word}", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerPutModerationRule))
+	mux.HandleFunc("DELETE /admin/moderation/rules/{word}", apiCfg.middlewareRequireRole(auth.RoleAdmin, apiCfg.handlerDeleteModerationRule))
+	mux.HandleFunc("GET /admin/moderation/flags", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerGetChirpFlags))
+	mux.HandleFunc("GET /admin/reports", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerListReports))
+	mux.HandleFunc("PATCH /admin/reports/{reportId}", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerUpdateReport))
+	mux.HandleFunc("POST /admin/chirps/{chirpId}/hide", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerHideChirp))
+	mux.HandleFunc("DELETE /admin/chirps/{chirpId}/hide", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerUnhideChirp))
+	mux.HandleFunc("DELETE /admin/chirps/{chirpId}", apiCfg.middlewareRequireRole(auth.RoleModerator, apiCfg.handlerAdminDeleteChirp))
 	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
-	mux.HandleFunc("PUT /api/users", apiCfg.handlerUpdateUser)
+	mux.HandleFunc("PUT /api/users", apiCfg.middlewareAuthorize(apiCfg.handlerUpdateUser))
+	mux.HandleFunc("GET /api/users/me", apiCfg.middlewareAuthorizeScope(auth.ScopeProfileRead, apiCfg.handlerGetMe))
+	mux.HandleFunc("DELETE /api/users/me", apiCfg.middlewareAuthorize(apiCfg.handlerDeleteMe))
+	mux.HandleFunc("GET /api/users/me/export", apiCfg.middlewareAuthorize(apiCfg.handlerExportMe))
+	mux.HandleFunc("GET /api/users/{username}", apiCfg.handlerGetUserProfile)
+	mux.HandleFunc("POST /api/users/verify", apiCfg.handlerVerifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", apiCfg.middlewareAuthorize(apiCfg.handlerResendVerification))
 	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
-	mux.HandleFunc("POST /api/chirps", apiCfg.middlewareAuthorize(middlewareValidate(apiCfg.handlerCreateChirp)))
-	mux.HandleFunc("DELETE /api/chirps/{chirpId}", apiCfg.middlewareAuthorize(apiCfg.handlerDeleteChirp))
-	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpId}", apiCfg.handlerGetChirpById)
+	mux.HandleFunc("POST /api/login/mfa", apiCfg.handlerLoginMFA)
+	mux.HandleFunc("GET /api/auth/oidc/start", apiCfg.handlerOIDCStart)
+	mux.HandleFunc("GET /api/auth/oidc/callback", apiCfg.handlerOIDCCallback)
+	mux.HandleFunc("POST /api/mfa/totp", apiCfg.middlewareAuthorize(apiCfg.handlerEnrollTOTP))
+	mux.HandleFunc("POST /api/mfa/totp/confirm", apiCfg.middlewareAuthorize(apiCfg.handlerConfirmTOTP))
+	mux.HandleFunc("DELETE /api/mfa/totp", apiCfg.middlewareAuthorize(apiCfg.handlerDisableTOTP))
+	mux.HandleFunc("POST /api/password/forgot", apiCfg.handlerForgotPassword)
+	mux.HandleFunc("POST /api/password/reset", apiCfg.handlerResetPassword)
+	mux.HandleFunc("POST /api/users/{id}/follow", apiCfg.middlewareAuthorize(apiCfg.handlerFollowUser))
+	mux.HandleFunc("DELETE /api/users/{id}/follow", apiCfg.middlewareAuthorize(apiCfg.handlerUnfollowUser))
+	mux.HandleFunc("GET /api/users/{id}/followers", apiCfg.handlerGetFollowers)
+	mux.HandleFunc("GET /api/users/{id}/following", apiCfg.handlerGetFollowing)
+	mux.HandleFunc("GET /api/users/me/mentions", apiCfg.middlewareAuthorizeScope(auth.ScopeChirpsRead, apiCfg.handlerGetMentions))
+	mux.HandleFunc("GET /api/timeline", apiCfg.middlewareAuthorizeScope(auth.ScopeChirpsRead, apiCfg.handlerGetTimeline))
+	mux.HandleFunc("GET /api/tags/{tag}/chirps", apiCfg.middlewareIdentify(apiCfg.handlerGetTagChirps))
+	mux.HandleFunc("POST /api/chirps", apiCfg.middlewareAuthorizeScope(auth.ScopeChirpsWrite, apiCfg.middlewareValidate(apiCfg.handlerCreateChirp)))
+	mux.HandleFunc("PATCH /api/chirps/{chirpId}", apiCfg.middlewareAuthorizeScope(auth.ScopeChirpsWrite, apiCfg.middlewareValidate(apiCfg.handlerUpdateChirp)))
+	mux.HandleFunc("DELETE /api/chirps/{chirpId}", apiCfg.middlewareAuthorizeScope(auth.ScopeChirpsWrite, apiCfg.handlerDeleteChirp))
+	mux.HandleFunc("GET /api/chirps", apiCfg.middlewareIdentify(apiCfg.handlerGetChirps))
+	mux.HandleFunc("GET /api/chirps/search", apiCfg.middlewareIdentify(apiCfg.handlerSearchChirps))
+	mux.HandleFunc("GET /api/chirps/{chirpId}", apiCfg.middlewareIdentify(apiCfg.handlerGetChirpById))
+	mux.HandleFunc("GET /api/chirps/{chirpId}/revisions", apiCfg.middlewareIdentify(apiCfg.handlerGetChirpRevisions))
+	mux.HandleFunc("GET /api/chirps/{chirpId}/replies", apiCfg.middlewareIdentify(apiCfg.handlerGetChirpReplies))
+	mux.HandleFunc("POST /api/chirps/{chirpId}/reports", apiCfg.middlewareAuthorize(apiCfg.handlerCreateReport))
+	mux.HandleFunc("POST /api/chirps/{chirpId}/likes", apiCfg.middlewareAuthorizeScope(auth.ScopeChirpsWrite, apiCfg.handlerLikeChirp))
+	mux.HandleFunc("DELETE /api/chirps/{chirpId}/likes", apiCfg.middlewareAuthorizeScope(auth.ScopeChirpsWrite, apiCfg.handlerUnlikeChirp))
 	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
+	mux.HandleFunc("GET /api/sessions", apiCfg.middlewareAuthorize(apiCfg.handlerListSessions))
+	mux.HandleFunc("DELETE /api/sessions/{id}", apiCfg.middlewareAuthorize(apiCfg.handlerRevokeSession))
+	mux.HandleFunc("POST /api/logout-all", apiCfg.middlewareAuthorize(apiCfg.handlerLogoutAll))
+	mux.HandleFunc("POST /api/keys", apiCfg.middlewareAuthorize(apiCfg.handlerCreateAPIKey))
+	mux.HandleFunc("GET /api/keys", apiCfg.middlewareAuthorize(apiCfg.handlerListAPIKeys))
+	mux.HandleFunc("DELETE /api/keys/{id}", apiCfg.middlewareAuthorize(apiCfg.handlerRevokeAPIKey))
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerWebhookPolka)
 
+	go apiCfg.purgeDeletedAccounts(context.Background(), time.Hour)
+
 	srv := &http.Server{
 		Addr:    ":" + port,
 		Handler: mux,
@@ -71,6 +202,19 @@ func main() {
 	log.Fatal(srv.ListenAndServe())
 }
 
+// newMailer delivers over SMTP when MAIL_SMTP_ADDR is set, otherwise mail is
+// written to MAIL_FILE or the log.
+func newMailer() mailer.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@chirpy.local>"
+	}
+	if addr := os.Getenv("MAIL_SMTP_ADDR"); addr != "" {
+		return mailer.NewSMTPMailer(addr, from, os.Getenv("MAIL_SMTP_USERNAME"), os.Getenv("MAIL_SMTP_PASSWORD"))
+	}
+	return mailer.NewFileMailer(os.Getenv("MAIL_FILE"), from)
+}
+
 func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
@@ -89,21 +233,119 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	})
 }
 
+// middlewareAuthorize only accepts access tokens. Routes that personal API
+// keys may call use middlewareAuthorizeScope instead.
 func (cfg *apiConfig) middlewareAuthorize(next http.HandlerFunc) http.HandlerFunc {
-	log.Printf("authorizing")
+	return cfg.middlewareAuthorizeScope("", next)
+}
+
+// middlewareAuthorizeScope accepts an access token, or an API key carrying
+// scope. API key callers always get the plain user role.
+func (cfg *apiConfig) middlewareAuthorizeScope(scope auth.Scope, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key, err := auth.GetAPIKey(r.Header); err == nil {
+			if scope == "" {
+				respondWithError(w, 403, "API keys can't be used here", nil)
+				return
+			}
+			apiKey, err := cfg.authenticateAPIKey(r, key)
+			if err != nil {
+				respondWithError(w, 401, "Unauthorized", err)
+				return
+			}
+			if !auth.HasScope(apiKey.Scopes, scope) {
+				respondWithError(w, 403, "API key is missing scope "+string(scope), nil)
+				return
+			}
+			cfg.serveAuthorized(w, r, next, apiKey.UserID, auth.RoleUser)
+			return
+		}
+
 		token, err := auth.GetBearerToken(r.Header)
 		if err != nil {
 			respondWithError(w, 401, "Unauthorized", err)
 			return
 		}
 
-		userId, err := auth.ValidateJWT(token, cfg.jwtSecret)
+		userId, role, err := auth.ValidateJWT(token, cfg.jwtKeys)
 		if err != nil {
 			respondWithError(w, 401, "Unauthorized", err)
 			return
 		}
-		ctx := context.WithValue(r.Context(), "userId", userId)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		cfg.serveAuthorized(w, r, next, userId, role)
+	})
+}
+
+// serveAuthorized passes the request on with the caller in its context.
+// Accounts scheduled for deletion are signed out everywhere, but an access
+// token stays valid until it expires, so they are rejected here until a new
+// login cancels the deletion.
+func (cfg *apiConfig) serveAuthorized(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, userId uuid.UUID, role auth.Role) {
+	pending, err := cfg.db.IsAccountPendingDeletion(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 500, "Error checking account", err)
+		return
+	}
+	if pending {
+		respondWithError(w, 401, "Account is scheduled for deletion, log in again to cancel", nil)
+		return
+	}
+	ctx := context.WithValue(r.Context(), "userId", userId)
+	ctx = context.WithValue(ctx, "userRole", role)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// middlewareRequireRole authorizes the request and rejects callers whose role
+// is below the given one.
+func (cfg *apiConfig) middlewareRequireRole(role auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return cfg.middlewareAuthorize(func(w http.ResponseWriter, r *http.Request) {
+		userRole, _ := r.Context().Value("userRole").(auth.Role)
+		if !userRole.AtLeast(role) {
+			respondWithError(w, 403, "Forbidden", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
 	})
 }
+
+// middlewareIdentify attaches the caller's userId and userRole when a valid
+// bearer token is present, but lets anonymous requests through.
+func (cfg *apiConfig) middlewareIdentify(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key, err := auth.GetAPIKey(r.Header); err == nil {
+			apiKey, err := cfg.authenticateAPIKey(r, key)
+			if err != nil || !auth.HasScope(apiKey.Scopes, auth.ScopeChirpsRead) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cfg.serveIdentified(w, r, next, apiKey.UserID, auth.RoleUser)
+			return
+		}
+
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userId, role, err := auth.ValidateJWT(token, cfg.jwtKeys)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cfg.serveIdentified(w, r, next, userId, role)
+	})
+}
+
+// serveIdentified is serveAuthorized for optional authentication: accounts
+// scheduled for deletion are served as anonymous instead of rejected.
+func (cfg *apiConfig) serveIdentified(w http.ResponseWriter, r *http.Request, next http.HandlerFunc, userId uuid.UUID, role auth.Role) {
+	pending, err := cfg.db.IsAccountPendingDeletion(r.Context(), userId)
+	if err != nil || pending {
+		next.ServeHTTP(w, r)
+		return
+	}
+	ctx := context.WithValue(r.Context(), "userId", userId)
+	ctx = context.WithValue(ctx, "userRole", role)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+// newTestConfig returns an apiConfig backed by a sqlmock connection. Only use
+// it where the order of statements is what the test checks; decisions belong
+// in plain functions tested on their own.
+func newTestConfig(t *testing.T) (*apiConfig, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error = %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet sql expectations: %v", err)
+		}
+	})
+	return &apiConfig{db: database.New(conn), conn: conn}, mock
+}
+
+// mockRows turns generated models into sqlmock rows. Columns follow the
+// struct fields, which sqlc keeps in table order, so tests don't repeat column
+// lists that go stale with the schema.
+func mockRows(models ...interface{}) *sqlmock.Rows {
+	typ := reflect.TypeOf(models[0])
+	columns := make([]string, typ.NumField())
+	for i := range columns {
+		columns[i] = typ.Field(i).Name
+	}
+
+	rows := sqlmock.NewRows(columns)
+	for _, m := range models {
+		v := reflect.ValueOf(m)
+		row := make([]driver.Value, len(columns))
+		for i := range row {
+			field := v.Field(i).Interface()
+			if valuer, ok := field.(driver.Valuer); ok {
+				field, _ = valuer.Value()
+			}
+			row[i] = field
+		}
+		rows.AddRow(row...)
+	}
+	return rows
+}
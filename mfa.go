@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/auth"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+const (
+	totpIssuer          = "Chirpy"
+	mfaChallengeTTL     = 5 * time.Minute
+	recoveryCodeCount   = 10
+	mfaLockoutThreshold = 5
+)
+
+var errTOTPAlreadyEnabled = errors.New("two-factor authentication already enabled")
+
+type requestSecondFactor struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func readSecondFactor(r *http.Request) (requestSecondFactor, error) {
+	defer r.Body.Close()
+	rq := requestSecondFactor{}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return rq, err
+	}
+	err = json.Unmarshal(data, &rq)
+	return rq, err
+}
+
+// handlerEnrollTOTP starts enrollment with a fresh secret. TOTP only becomes
+// required at login once a code from it is confirmed.
+func (cfg *apiConfig) handlerEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+
+	user, err := cfg.db.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 404, "User doesn't exist", err)
+		return
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, 500, "Error generating secret", err)
+		return
+	}
+
+	_, err = cfg.db.UpsertPendingTOTP(r.Context(), database.UpsertPendingTOTPParams{UserID: userId, Secret: secret})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 409, "Two-factor authentication is already enabled", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, 400, "Error saving secret", err)
+		return
+	}
+
+	respondWithJson(w, 201, responseTOTPEnrollment{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(totpIssuer, user.Email, secret),
+	})
+}
+
+func (cfg *apiConfig) handlerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+
+	rq, err := readSecondFactor(r)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshaling json", err)
+		return
+	}
+
+	totp, err := cfg.db.GetUserTOTP(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 404, "Two-factor enrollment not started", err)
+		return
+	}
+	if totp.EnabledAt.Valid {
+		respondWithError(w, 409, "Two-factor authentication is already enabled", nil)
+		return
+	}
+	step, ok := auth.ValidateTOTP(totp.Secret, rq.Code, time.Now())
+	if !ok {
+		respondWithError(w, 400, "Invalid code", nil)
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, 500, "Error creating recovery codes", err)
+		return
+	}
+	// TOTP is only enforced once the recovery codes are stored with it, so a
+	// failure can't leave the account without a way back in.
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		enabled, err := q.EnableUserTOTP(r.Context(), database.EnableUserTOTPParams{UserID: userId, LastUsedStep: step})
+		if err != nil {
+			return err
+		}
+		if enabled == 0 {
+			return errTOTPAlreadyEnabled
+		}
+		return replaceRecoveryCodes(r.Context(), q, userId, codes)
+	})
+	if errors.Is(err, errTOTPAlreadyEnabled) {
+		respondWithError(w, 409, "Two-factor authentication is already enabled", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error enabling two-factor authentication", err)
+		return
+	}
+	respondWithJson(w, 200, responseRecoveryCodes{RecoveryCodes: codes})
+}
+
+func (cfg *apiConfig) handlerDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+
+	rq, err := readSecondFactor(r)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshaling json", err)
+		return
+	}
+
+	keys := mfaKeys(userId)
+	lockedUntil, err := cfg.loginLockedUntil(r.Context(), keys)
+	if err != nil {
+		respondWithError(w, 500, "Error checking login attempts", err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		respondLoginLocked(w, lockedUntil)
+		return
+	}
+
+	totp, err := cfg.db.GetUserTOTP(r.Context(), userId)
+	if err != nil || !totp.EnabledAt.Valid {
+		respondWithError(w, 404, "Two-factor authentication is not enabled", err)
+		return
+	}
+	ok, err := cfg.checkSecondFactor(r.Context(), totp, rq)
+	if err != nil {
+		respondWithError(w, 500, "Error checking code", err)
+		return
+	}
+	if !ok {
+		cfg.recordFailedLogin(r.Context(), keys)
+		respondWithError(w, 401, "Invalid code", nil)
+		return
+	}
+	err = cfg.db.ClearLoginAttempts(r.Context(), keys[0].key)
+	if err != nil {
+		log.Printf("Error clearing login attempts: %v", err)
+	}
+
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		err := q.DeleteUserTOTP(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		return q.DeleteRecoveryCodes(r.Context(), userId)
+	})
+	if err != nil {
+		respondWithError(w, 400, "Error disabling two-factor authentication", err)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// mfaKeys is the counter failed second factor codes are tracked under, shared
+// by login and disabling TOTP so neither can be used to guess codes freely.
+func mfaKeys(userId uuid.UUID) []loginKey {
+	return []loginKey{{key: "mfa:" + userId.String(), threshold: mfaLockoutThreshold}}
+}
+
+// handlerLoginMFA finishes a login that handlerLogin answered with an MFA
+// challenge. Failed codes count towards a lockout on the account.
+func (cfg *apiConfig) handlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	rq, err := readSecondFactor(r)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshaling json", err)
+		return
+	}
+
+	userId, err := auth.ValidateMFAChallengeToken(rq.MFAToken, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(w, 401, "Invalid or expired MFA token", err)
+		return
+	}
+
+	keys := mfaKeys(userId)
+	lockedUntil, err := cfg.loginLockedUntil(r.Context(), keys)
+	if err != nil {
+		respondWithError(w, 500, "Error checking login attempts", err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		respondLoginLocked(w, lockedUntil)
+		return
+	}
+
+	totp, err := cfg.db.GetUserTOTP(r.Context(), userId)
+	if err != nil || !totp.EnabledAt.Valid {
+		respondWithError(w, 401, "Invalid or expired MFA token", err)
+		return
+	}
+	ok, err := cfg.checkSecondFactor(r.Context(), totp, rq)
+	if err != nil {
+		respondWithError(w, 500, "Error checking code", err)
+		return
+	}
+	if !ok {
+		cfg.recordFailedLogin(r.Context(), keys)
+		respondWithError(w, 401, "Invalid code", nil)
+		return
+	}
+	err = cfg.db.ClearLoginAttempts(r.Context(), keys[0].key)
+	if err != nil {
+		log.Printf("Error clearing login attempts: %v", err)
+	}
+
+	user, err := cfg.db.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 401, "Invalid or expired MFA token", err)
+		return
+	}
+	cfg.respondWithLogin(w, r, user)
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code.
+// Each is consumed atomically so the same code can't be used twice.
+func (cfg *apiConfig) checkSecondFactor(ctx context.Context, totp database.UserTotp, rq requestSecondFactor) (bool, error) {
+	if rq.RecoveryCode != "" {
+		used, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   totp.UserID,
+			CodeHash: auth.HashRecoveryCode(rq.RecoveryCode),
+		})
+		return used == 1, err
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, rq.Code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	used, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{UserID: totp.UserID, LastUsedStep: step})
+	return used == 1, err
+}
+
+// replaceRecoveryCodes swaps the user's recovery codes for codes. q should
+// belong to the transaction that enables TOTP.
+func replaceRecoveryCodes(ctx context.Context, q *database.Queries, userId uuid.UUID, codes []string) error {
+	err := q.DeleteRecoveryCodes(ctx, userId)
+	if err != nil {
+		return err
+	}
+	for _, code := range codes {
+		err = q.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{UserID: userId, CodeHash: auth.HashRecoveryCode(code)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/auth"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+func TestHandlerDisableTOTPLockout(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	validCode, err := auth.TOTPCode(secret, auth.TOTPStep(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongCode := string('0'+(validCode[0]-'0'+1)%10) + validCode[1:]
+
+	tests := []struct {
+		name       string
+		locked     bool
+		code       string
+		wantStatus int
+	}{
+		{name: "locked out", locked: true, code: validCode, wantStatus: 429},
+		{name: "wrong code counts a failure", code: wrongCode, wantStatus: 401},
+		{name: "valid code clears the counter", code: validCode, wantStatus: 204},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			userId := uuid.New()
+			mfaKey := "mfa:" + userId.String()
+
+			lockouts := sqlmock.NewRows(nil)
+			if tt.locked {
+				lockouts = mockRows(database.LoginAttempt{Key: mfaKey, FailedCount: 5, LockedUntil: sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true}})
+			}
+			mock.ExpectQuery("FROM login_attempts").WillReturnRows(lockouts)
+			if !tt.locked {
+				mock.ExpectQuery("FROM user_totp").WithArgs(userId).
+					WillReturnRows(mockRows(database.UserTotp{UserID: userId, Secret: secret, EnabledAt: sql.NullTime{Time: time.Now(), Valid: true}}))
+			}
+			switch tt.wantStatus {
+			case 401:
+				mock.ExpectQuery("INSERT INTO login_attempts").WithArgs(mfaKey, sqlmock.AnyArg()).
+					WillReturnRows(mockRows(database.LoginAttempt{Key: mfaKey, FailedCount: 1, LastFailedAt: time.Now()}))
+			case 204:
+				mock.ExpectExec("UPDATE user_totp").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("DELETE FROM login_attempts").WithArgs(mfaKey).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec("DELETE FROM user_totp").WithArgs(userId).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("DELETE FROM mfa_recovery_codes").WithArgs(userId).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectCommit()
+			}
+
+			req := httptest.NewRequest("DELETE", "/api/mfa/totp", strings.NewReader(`{"code":"`+tt.code+`"}`))
+			req = req.WithContext(context.WithValue(req.Context(), "userId", userId))
+			rec := httptest.NewRecorder()
+			cfg.handlerDisableTOTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
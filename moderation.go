@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mikarwacki/chirpy/internal/database"
+	"github.com/mikarwacki/chirpy/internal/moderation"
+)
+
+// reloadModerationRules rebuilds the filter from the optional rules file and
+// the moderation_rules table. Rules stored in the database win over the file.
+// File rules are read-only through the admin API: a PUT overrides one until
+// the database rule is deleted, and removing it for good means editing the
+// file.
+func (cfg *apiConfig) reloadModerationRules(ctx context.Context) error {
+	rules := []moderation.Rule{}
+	if cfg.moderationRulesFile != "" {
+		fileRules, err := moderation.LoadRulesFile(cfg.moderationRulesFile)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, fileRules...)
+	}
+
+	dbRules, err := cfg.db.GetModerationRules(ctx)
+	if err != nil {
+		return err
+	}
+	for _, dbRule := range dbRules {
+		action, err := moderation.ParseAction(dbRule.Action)
+		if err != nil {
+			log.Printf("Skipping moderation rule %q: %v", dbRule.Word, err)
+			continue
+		}
+		rules = append(rules, moderation.Rule{Word: dbRule.Word, Action: action})
+	}
+
+	cfg.moderation.SetRules(rules)
+	return nil
+}
+
+// flagChirpIfNeeded records chirps that middlewareValidate let through but
+// marked for review. It runs in the transaction that wrote the chirp.
+func flagChirpIfNeeded(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	flagged, ok := ctx.Value("moderationFlags").([]string)
+	if !ok || len(flagged) == 0 {
+		return nil
+	}
+	return q.FlagChirp(ctx, database.FlagChirpParams{ChirpID: chirp.ID, Words: strings.Join(flagged, ",")})
+}
+
+func (cfg *apiConfig) handlerGetModerationRules(w http.ResponseWriter, r *http.Request) {
+	rules := cfg.moderation.Rules()
+	rRules := make([]responseModerationRule, len(rules))
+	for i, rule := range rules {
+		rRules[i] = responseModerationRule{Word: rule.Word, Action: string(rule.Action)}
+	}
+	respondWithJson(w, 200, rRules)
+}
+
+func (cfg *apiConfig) handlerPutModerationRule(w http.ResponseWriter, r *http.Request) {
+	type ruleRequest struct {
+		Action string `json:"action"`
+	}
+
+	word := strings.ToLower(strings.TrimSpace(r.PathValue("word")))
+	if word == "" {
+		respondWithError(w, 400, "Word is required", nil)
+		return
+	}
+
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 500, "Error reading request body", err)
+		return
+	}
+
+	rq := ruleRequest{}
+	err = json.Unmarshal(data, &rq)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshaling json", err)
+		return
+	}
+	action, err := moderation.ParseAction(rq.Action)
+	if err != nil {
+		respondWithError(w, 400, "Action must be mask, reject or flag", err)
+		return
+	}
+
+	rule, err := cfg.db.UpsertModerationRule(r.Context(), database.UpsertModerationRuleParams{Word: word, Action: string(action)})
+	if err != nil {
+		respondWithError(w, 400, "Error saving moderation rule", err)
+		return
+	}
+	err = cfg.reloadModerationRules(r.Context())
+	if err != nil {
+		respondWithError(w, 500, "Error reloading moderation rules", err)
+		return
+	}
+
+	respondWithJson(w, 200, responseModerationRule{Word: rule.Word, Action: rule.Action})
+}
+
+func (cfg *apiConfig) handlerDeleteModerationRule(w http.ResponseWriter, r *http.Request) {
+	word := strings.ToLower(strings.TrimSpace(r.PathValue("word")))
+	deleted, err := cfg.db.DeleteModerationRule(r.Context(), word)
+	if err != nil {
+		respondWithError(w, 400, "Error deleting moderation rule", err)
+		return
+	}
+	if deleted == 0 {
+		// Nothing in the database, so an active rule must come from the file.
+		if hasModerationRule(cfg.moderation.Rules(), word) {
+			respondWithError(w, 409, "Moderation rule comes from the rules file and can only be removed there", nil)
+			return
+		}
+		respondWithError(w, 404, "Moderation rule doesn't exist", nil)
+		return
+	}
+	err = cfg.reloadModerationRules(r.Context())
+	if err != nil {
+		respondWithError(w, 500, "Error reloading moderation rules", err)
+		return
+	}
+
+	respondWithJson(w, 204, nil)
+}
+
+func (cfg *apiConfig) handlerGetChirpFlags(w http.ResponseWriter, r *http.Request) {
+	flags, err := cfg.db.GetChirpFlags(r.Context())
+	if err != nil {
+		respondWithError(w, 400, "Error getting flagged chirps", err)
+		return
+	}
+
+	rFlags := make([]responseChirpFlag, len(flags))
+	for i, flag := range flags {
+		rFlags[i] = responseChirpFlag{ChirpID: flag.ChirpID, Words: strings.Split(flag.Words, ","), CreatedAt: flag.CreatedAt}
+	}
+	respondWithJson(w, 200, rFlags)
+}
+
+func hasModerationRule(rules []moderation.Rule, word string) bool {
+	for _, rule := range rules {
+		if rule.Word == word {
+			return true
+		}
+	}
+	return false
+}
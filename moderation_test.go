@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mikarwacki/chirpy/internal/moderation"
+)
+
+func TestHasModerationRule(t *testing.T) {
+	rules := []moderation.Rule{{Word: "frobnicate", Action: moderation.ActionFlag}}
+	tests := []struct {
+		name string
+		word string
+		want bool
+	}{
+		{name: "active rule", word: "frobnicate", want: true},
+		{name: "unknown rule", word: "fornax", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasModerationRule(rules, tt.word); got != tt.want {
+				t.Errorf("hasModerationRule(%q) = %v, want %v", tt.word, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mikarwacki/chirpy/internal/auth"
+	"github.com/mikarwacki/chirpy/internal/database"
+	"github.com/mikarwacki/chirpy/internal/oidc"
+)
+
+const (
+	oidcStateTTL    = 10 * time.Minute
+	oidcStateCookie = "chirpy_oidc_state"
+	reauthTokenTTL  = 5 * time.Minute
+)
+
+var oidcPurposes = map[string]struct{}{"login": {}, "reauth": {}}
+
+// handlerOIDCStart redirects the browser to the provider. The state, nonce and
+// PKCE verifier are kept server side until the callback consumes them, and the
+// state is also set in a cookie so the callback only completes in the browser
+// that started it. With ?purpose=reauth the callback answers with a reauth
+// token instead of logging in.
+func (cfg *apiConfig) handlerOIDCStart(w http.ResponseWriter, r *http.Request) {
+	if cfg.oidc == nil {
+		respondWithError(w, 404, "OIDC login is not configured", nil)
+		return
+	}
+	purpose := r.URL.Query().Get("purpose")
+	if purpose == "" {
+		purpose = "login"
+	}
+	if _, ok := oidcPurposes[purpose]; !ok {
+		respondWithError(w, 400, "Purpose must be login or reauth", nil)
+		return
+	}
+
+	verifier, challenge, err := oidc.NewPKCEVerifier()
+	if err != nil {
+		respondWithError(w, 500, "Error starting login", err)
+		return
+	}
+	state, err := oidc.RandomValue()
+	if err != nil {
+		respondWithError(w, 500, "Error starting login", err)
+		return
+	}
+	nonce, err := oidc.RandomValue()
+	if err != nil {
+		respondWithError(w, 500, "Error starting login", err)
+		return
+	}
+
+	authURL, err := cfg.oidc.AuthCodeURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		respondWithError(w, 502, "Error contacting identity provider", err)
+		return
+	}
+	err = cfg.db.CreateOIDCState(r.Context(), database.CreateOIDCStateParams{
+		StateHash:    auth.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+		Purpose:      purpose,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error starting login", err)
+		return
+	}
+	err = cfg.db.DeleteExpiredOIDCStates(r.Context())
+	if err != nil {
+		log.Printf("Error deleting expired oidc states: %v", err)
+	}
+
+	cfg.setOIDCStateCookie(w, state, int(oidcStateTTL.Seconds()))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// setOIDCStateCookie binds a login to the browser. A negative maxAge clears
+// the cookie.
+func (cfg *apiConfig) setOIDCStateCookie(w http.ResponseWriter, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   cfg.platform != "dev",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (cfg *apiConfig) handlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if cfg.oidc == nil {
+		respondWithError(w, 404, "OIDC login is not configured", nil)
+		return
+	}
+	q := r.URL.Query()
+	if providerErr := q.Get("error"); providerErr != "" {
+		respondWithError(w, 401, "Identity provider refused login: "+providerErr, nil)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(q.Get("state"))) != 1 {
+		respondWithError(w, 400, "Login state doesn't match this browser", err)
+		return
+	}
+	cfg.setOIDCStateCookie(w, "", -1)
+
+	state, err := cfg.db.ConsumeOIDCState(r.Context(), auth.HashToken(q.Get("state")))
+	if err != nil {
+		respondWithError(w, 400, "Invalid or expired login state", err)
+		return
+	}
+	claims, err := cfg.oidc.Exchange(r.Context(), q.Get("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		respondWithError(w, 401, "Error verifying identity provider login", err)
+		return
+	}
+
+	if state.Purpose == "reauth" {
+		cfg.respondWithReauth(w, r, claims)
+		return
+	}
+
+	user, err := cfg.userForIdentity(r.Context(), claims)
+	if err != nil {
+		if isUniqueViolation(err) || errors.Is(err, errIdentityEmailTaken) {
+			respondWithError(w, 409, "An account with this email already exists, log in with your password", err)
+			return
+		}
+		respondWithError(w, 400, "Error signing in", err)
+		return
+	}
+	cfg.respondWithLoginOrChallenge(w, r, user)
+}
+
+// respondWithReauth answers a reauth callback with a short-lived token for the
+// account linked to the identity. It never creates or links accounts.
+func (cfg *apiConfig) respondWithReauth(w http.ResponseWriter, r *http.Request, claims oidc.Claims) {
+	identity, err := cfg.db.GetUserIdentity(r.Context(), database.GetUserIdentityParams{Provider: cfg.oidcProvider, Subject: claims.Subject})
+	if err != nil {
+		respondWithError(w, 401, "No account is linked to this identity", err)
+		return
+	}
+	token, err := auth.MakeReauthToken(identity.UserID, cfg.jwtKeys, reauthTokenTTL)
+	if err != nil {
+		respondWithError(w, 500, "Error making reauth token", err)
+		return
+	}
+	respondWithJson(w, 200, responseReauth{ReauthToken: token})
+}
+
+var errIdentityEmailTaken = errors.New("email belongs to an account that can't be linked")
+
+// userForIdentity finds the user linked to a provider subject. New subjects
+// are linked to an existing account when canLinkIdentity allows it, and get a
+// new account when nobody has the email yet.
+func (cfg *apiConfig) userForIdentity(ctx context.Context, claims oidc.Claims) (database.User, error) {
+	identity, err := cfg.db.GetUserIdentity(ctx, database.GetUserIdentityParams{Provider: cfg.oidcProvider, Subject: claims.Subject})
+	if err == nil {
+		return cfg.db.GetUserById(ctx, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+	if claims.Email == "" {
+		return database.User{}, errors.New("identity provider didn't return an email")
+	}
+
+	user, err := cfg.db.GetUserByEmail(ctx, claims.Email)
+	switch {
+	case err == nil && canLinkIdentity(user, claims):
+		// Link the existing account.
+	case err == nil:
+		return database.User{}, errIdentityEmailTaken
+	case !errors.Is(err, sql.ErrNoRows):
+		return database.User{}, err
+	}
+	create := err != nil
+
+	// A new account and its identity are stored together, so a failed link
+	// can't leave an account behind that blocks the email.
+	err = cfg.withTx(ctx, func(q *database.Queries) error {
+		if create {
+			user, err = createIdentityUser(ctx, q, claims)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = q.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+			UserID:   user.ID,
+			Provider: cfg.oidcProvider,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		})
+		return err
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, nil
+}
+
+// canLinkIdentity requires both the provider and the account to have verified
+// the email address. An unverified account could have been registered by
+// someone else who knows its password, so linking it would hand them the
+// provider's sign-in.
+func canLinkIdentity(user database.User, claims oidc.Claims) bool {
+	return claims.EmailVerified && user.EmailVerifiedAt.Valid
+}
+
+// createIdentityUser creates an account without a usable password. The owner
+// can set one later through the password reset flow, and until then confirms
+// sensitive actions such as deleting the account with a reauth token from
+// /api/auth/oidc/start?purpose=reauth.
+func createIdentityUser(ctx context.Context, q *database.Queries, claims oidc.Claims) (database.User, error) {
+	password, err := auth.MakeOpaqueToken()
+	if err != nil {
+		return database.User{}, err
+	}
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return database.User{}, err
+	}
+	user, err := q.CreateUser(ctx, database.CreateUserParams{Email: claims.Email, HashedPassword: hashedPassword})
+	if err != nil {
+		return database.User{}, err
+	}
+	if claims.EmailVerified {
+		return q.VerifyUserEmail(ctx, database.VerifyUserEmailParams{ID: user.ID, Email: user.Email})
+	}
+	return user, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/auth"
+	"github.com/mikarwacki/chirpy/internal/database"
+	"github.com/mikarwacki/chirpy/internal/oidc"
+)
+
+func TestHandlerOIDCCallbackRequiresStateCookie(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		{name: "missing cookie"},
+		{name: "other browser's state", cookie: "someone-elses-state"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// No sql expectations: the state must be rejected before it is consumed.
+			cfg, _ := newTestConfig(t)
+			cfg.oidc = oidc.NewProvider(oidc.Config{Issuer: "https://idp.example.com"}, nil)
+
+			req := httptest.NewRequest("GET", "/api/auth/oidc/callback?state=victim-state&code=attacker-code", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			cfg.handlerOIDCCallback(rec, req)
+
+			if rec.Code != 400 {
+				t.Errorf("status = %d, want 400", rec.Code)
+			}
+		})
+	}
+}
+
+func TestConfirmAccountOwnerReauthToken(t *testing.T) {
+	keys := auth.NewHMACKeySet("secret")
+	userId := uuid.New()
+	ownToken, _ := auth.MakeReauthToken(userId, keys, reauthTokenTTL)
+	otherToken, _ := auth.MakeReauthToken(uuid.New(), keys, reauthTokenTTL)
+	challenge, _ := auth.MakeMFAChallengeToken(userId, keys, mfaChallengeTTL)
+
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{name: "own token", token: ownToken, want: true},
+		{name: "another user's token", token: otherToken, want: false},
+		{name: "wrong token type", token: challenge, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t)
+			cfg.jwtKeys = keys
+
+			rec := httptest.NewRecorder()
+			got := cfg.confirmAccountOwner(rec, httptest.NewRequest("DELETE", "/api/users/me", nil), userId, "", tt.token)
+			if got != tt.want {
+				t.Errorf("confirmAccountOwner() = %v, want %v", got, tt.want)
+			}
+			if !got && rec.Code != 401 {
+				t.Errorf("status = %d, want 401", rec.Code)
+			}
+		})
+	}
+}
+
+func TestCanLinkIdentity(t *testing.T) {
+	verified := database.User{Email: "bob@example.com", EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true}}
+	unverified := database.User{Email: "bob@example.com"}
+
+	tests := []struct {
+		name          string
+		user          database.User
+		emailVerified bool
+		want          bool
+	}{
+		{name: "both verified", user: verified, emailVerified: true, want: true},
+		{name: "provider unverified", user: verified, emailVerified: false, want: false},
+		{name: "account unverified", user: unverified, emailVerified: true, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := oidc.Claims{Subject: "sub", Email: tt.user.Email, EmailVerified: tt.emailVerified}
+			if got := canLinkIdentity(tt.user, claims); got != tt.want {
+				t.Errorf("canLinkIdentity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
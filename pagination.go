@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type pageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func parsePageLimit(s string) (int32, error) {
+	if s == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if limit < 1 || limit > maxPageLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+	return int32(limit), nil
+}
+
+func encodeCursor(createdAt time.Time, id uuid.UUID) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, err
+	}
+	createdAtRaw, idRaw, ok := strings.Cut(string(data), "|")
+	if !ok {
+		return pageCursor{}, fmt.Errorf("malformed cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtRaw)
+	if err != nil {
+		return pageCursor{}, err
+	}
+	id, err := uuid.Parse(idRaw)
+	if err != nil {
+		return pageCursor{}, err
+	}
+	return pageCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+func (c pageCursor) nullTime() sql.NullTime {
+	return sql.NullTime{Time: c.CreatedAt, Valid: !c.CreatedAt.IsZero()}
+}
+
+func (c pageCursor) nullID() uuid.NullUUID {
+	return uuid.NullUUID{UUID: c.ID, Valid: c.ID != uuid.Nil}
+}
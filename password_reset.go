@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/auth"
+	"github.com/mikarwacki/chirpy/internal/database"
+	"github.com/mikarwacki/chirpy/internal/mailer"
+)
+
+const (
+	passwordResetTTL = 30 * time.Minute
+	// A new token isn't minted while one younger than this is still usable.
+	passwordResetResendInterval = 5 * time.Minute
+	passwordResetEmailThreshold = 3
+	passwordResetIPThreshold    = 10
+)
+
+// passwordResetKeys returns the login_attempts counters reset requests are
+// rate limited under. Every request counts, whether or not the email has an
+// account, so the limit doesn't reveal which ones do.
+func (cfg *apiConfig) passwordResetKeys(r *http.Request, email string) []loginKey {
+	return []loginKey{
+		{key: "reset:" + strings.ToLower(email), threshold: passwordResetEmailThreshold},
+		{key: "reset-ip:" + cfg.clientIP(r), threshold: passwordResetIPThreshold},
+	}
+}
+
+// handlerForgotPassword always answers 202 so it can't be used to find out
+// which emails have accounts. The token is created and mailed on the mail
+// queue to keep the response time the same either way.
+func (cfg *apiConfig) handlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	type forgotRequest struct {
+		Email string `json:"email"`
+	}
+
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 500, "Error reading request body", err)
+		return
+	}
+
+	rq := forgotRequest{}
+	err = json.Unmarshal(data, &rq)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshaling json", err)
+		return
+	}
+
+	keys := cfg.passwordResetKeys(r, rq.Email)
+	lockedUntil, err := cfg.loginLockedUntil(r.Context(), keys)
+	if err != nil {
+		respondWithError(w, 500, "Error checking password reset attempts", err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		respondRateLimited(w, lockedUntil, "Too many password reset requests, try again later")
+		return
+	}
+	cfg.recordFailedLogin(r.Context(), keys)
+
+	if !cfg.mailQueue.enqueue(func(ctx context.Context) { cfg.sendPasswordReset(ctx, rq.Email) }) {
+		log.Printf("Mail queue full, dropping password reset request")
+	}
+	w.WriteHeader(202)
+}
+
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, email string) {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error looking up user for password reset: %v", err)
+		return
+	}
+
+	recent, err := cfg.db.HasRecentPasswordResetToken(ctx, database.HasRecentPasswordResetTokenParams{
+		UserID:    user.ID,
+		CreatedAt: time.Now().Add(-passwordResetResendInterval),
+	})
+	if err != nil {
+		log.Printf("Error checking password reset tokens for user %v: %v", user.ID, err)
+		return
+	}
+	if recent {
+		return
+	}
+
+	token, err := auth.MakeOpaqueToken()
+	if err != nil {
+		log.Printf("Error creating password reset token: %v", err)
+		return
+	}
+	err = cfg.db.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	})
+	if err != nil {
+		log.Printf("Error storing password reset token for user %v: %v", user.ID, err)
+		return
+	}
+
+	err = cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Send the token below with your new password to POST /api/password/reset.\n\n%s\n\nThe token expires in %v. If you didn't ask for a reset, ignore this email.",
+			token, passwordResetTTL),
+	})
+	if err != nil {
+		log.Printf("Error sending password reset email to user %v: %v", user.ID, err)
+	}
+}
+
+func (cfg *apiConfig) handlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	type resetRequest struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 500, "Error reading request body", err)
+		return
+	}
+
+	rq := resetRequest{}
+	err = json.Unmarshal(data, &rq)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshaling json", err)
+		return
+	}
+	err = cfg.passwordPolicy.Validate(rq.Password)
+	if err != nil {
+		respondWithError(w, 422, err.Error(), nil)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(rq.Password)
+	if err != nil {
+		respondWithError(w, 500, "Error hashing password", err)
+		return
+	}
+
+	// The token is only spent if the password change and the sign-out commit
+	// with it.
+	var userId uuid.UUID
+	tokenValid := false
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		userId, err = q.ConsumePasswordResetToken(r.Context(), auth.HashToken(rq.Token))
+		if err != nil {
+			return err
+		}
+		tokenValid = true
+		err = q.SetUserPasswordHash(r.Context(), database.SetUserPasswordHashParams{ID: userId, HashedPassword: hashedPassword})
+		if err != nil {
+			return err
+		}
+		// Whoever had the old password may still hold a session or an API key.
+		err = q.RevokeAllForUser(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		return q.RevokeAllAPIKeysForUser(r.Context(), userId)
+	})
+	if err != nil && !tokenValid {
+		respondWithError(w, 400, "Invalid or expired reset token", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error updating password", err)
+		return
+	}
+	err = cfg.db.DeletePasswordResetTokensForUser(r.Context(), userId)
+	if err != nil {
+		log.Printf("Error deleting password reset tokens for user %v: %v", userId, err)
+	}
+	w.WriteHeader(204)
+}
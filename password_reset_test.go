@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/database"
+	"github.com/mikarwacki/chirpy/internal/mailer"
+)
+
+type recordingMailer struct {
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestPasswordResetKeys(t *testing.T) {
+	cfg := &apiConfig{}
+	req := httptest.NewRequest("POST", "/api/password/forgot", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+
+	want := []loginKey{
+		{key: "reset:alice@example.com", threshold: passwordResetEmailThreshold},
+		{key: "reset-ip:192.0.2.1", threshold: passwordResetIPThreshold},
+	}
+	if got := cfg.passwordResetKeys(req, "Alice@Example.com"); !reflect.DeepEqual(got, want) {
+		t.Errorf("passwordResetKeys() = %v, want %v", got, want)
+	}
+}
+
+func TestSendPasswordReset(t *testing.T) {
+	tests := []struct {
+		name     string
+		recent   bool
+		wantSent int
+	}{
+		{name: "mints and mails a token", wantSent: 1},
+		{name: "reuses a recent token", recent: true, wantSent: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			m := &recordingMailer{}
+			cfg.mailer = m
+			userId := uuid.New()
+
+			mock.ExpectQuery("FROM users").WithArgs("alice@example.com").
+				WillReturnRows(mockRows(database.User{ID: userId, Email: "alice@example.com", EmailVerifiedAt: sql.NullTime{Time: time.Now(), Valid: true}}))
+			mock.ExpectQuery("FROM password_reset_tokens").WithArgs(userId, sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(tt.recent))
+			if !tt.recent {
+				mock.ExpectExec("INSERT INTO password_reset_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			cfg.sendPasswordReset(context.Background(), "alice@example.com")
+
+			if len(m.sent) != tt.wantSent {
+				t.Errorf("sent %d emails, want %d", len(m.sent), tt.wantSent)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+var (
+	reportReasons  = map[string]struct{}{"spam": {}, "harassment": {}, "hate": {}, "misinformation": {}, "other": {}}
+	reportStatuses = map[string]struct{}{"open": {}, "dismissed": {}, "actioned": {}}
+)
+
+func (cfg *apiConfig) handlerCreateReport(w http.ResponseWriter, r *http.Request) {
+	type reportRequest struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+
+	userId := r.Context().Value("userId").(uuid.UUID)
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 500, "Error reading request body", err)
+		return
+	}
+
+	rq := reportRequest{}
+	err = json.Unmarshal(data, &rq)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshaling json", err)
+		return
+	}
+	if _, ok := reportReasons[rq.Reason]; !ok {
+		respondWithError(w, 400, "Reason must be spam, harassment, hate, misinformation or other", nil)
+		return
+	}
+
+	report, err := cfg.db.CreateReport(r.Context(), database.CreateReportParams{
+		ChirpID:    chirpId,
+		ReporterID: userId,
+		Reason:     rq.Reason,
+		Details:    rq.Details,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, 409, "Chirp already reported", err)
+			return
+		}
+		if isForeignKeyViolation(err) {
+			respondWithError(w, 404, "Chirp doesn't exist", err)
+			return
+		}
+		respondWithError(w, 400, "Error creating report", err)
+		return
+	}
+
+	respondWithJson(w, 201, *NewResponseReport(report))
+}
+
+func (cfg *apiConfig) handlerListReports(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if _, ok := reportStatuses[status]; status != "" && !ok {
+		respondWithError(w, 400, "Invalid report status", nil)
+		return
+	}
+
+	reports, err := cfg.db.ListReports(r.Context(), sql.NullString{String: status, Valid: status != ""})
+	if err != nil {
+		respondWithError(w, 400, "Error getting reports", err)
+		return
+	}
+
+	rReports := make([]responseReport, len(reports))
+	for i, report := range reports {
+		rReports[i] = *NewResponseReport(report)
+	}
+	respondWithJson(w, 200, rReports)
+}
+
+func (cfg *apiConfig) handlerUpdateReport(w http.ResponseWriter, r *http.Request) {
+	type reportRequest struct {
+		Status string `json:"status"`
+	}
+
+	reportId, err := uuid.Parse(r.PathValue("reportId"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 500, "Error reading request body", err)
+		return
+	}
+
+	rq := reportRequest{}
+	err = json.Unmarshal(data, &rq)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshaling json", err)
+		return
+	}
+	if _, ok := reportStatuses[rq.Status]; !ok {
+		respondWithError(w, 400, "Status must be open, dismissed or actioned", nil)
+		return
+	}
+
+	report, err := cfg.db.UpdateReportStatus(r.Context(), database.UpdateReportStatusParams{ID: reportId, Status: rq.Status})
+	if err != nil {
+		respondWithError(w, 404, "Report doesn't exist", err)
+		return
+	}
+	respondWithJson(w, 200, *NewResponseReport(report))
+}
+
+func (cfg *apiConfig) handlerHideChirp(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+	_, err = cfg.db.GetChirpById(r.Context(), chirpId)
+	if err != nil {
+		respondWithError(w, 404, "Chirp doesn't exist", err)
+		return
+	}
+
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		err := q.HideChirpById(r.Context(), chirpId)
+		if err != nil {
+			return err
+		}
+		return q.ResolveChirpReports(r.Context(), chirpId)
+	})
+	if err != nil {
+		respondWithError(w, 400, "Error hiding chirp", err)
+		return
+	}
+	respondWithJson(w, 204, nil)
+}
+
+func (cfg *apiConfig) handlerUnhideChirp(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+
+	err = cfg.db.UnhideChirpById(r.Context(), chirpId)
+	if err != nil {
+		respondWithError(w, 400, "Error unhiding chirp", err)
+		return
+	}
+	respondWithJson(w, 204, nil)
+}
+
+func (cfg *apiConfig) handlerAdminDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	chirpId, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+	dbChirp, err := cfg.db.GetChirpById(r.Context(), chirpId)
+	if err != nil || dbChirp.DeletedAt.Valid {
+		respondWithError(w, 404, "Chirp doesn't exist", err)
+		return
+	}
+
+	// Reports only outlive the chirp when it is tombstoned, so resolve them in
+	// the same transaction that removes it.
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		err := q.ResolveChirpReports(r.Context(), chirpId)
+		if err != nil {
+			return err
+		}
+		return removeChirp(r.Context(), q, chirpId)
+	})
+	if err != nil {
+		respondWithError(w, 400, "Error deleting chirp", err)
+		return
+	}
+	respondWithJson(w, 204, nil)
+}
@@ -1,15 +1,172 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
 
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/auth"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+type fixtureUser struct {
+	Email       string   `json:"email"`
+	Password    string   `json:"password"`
+	Username    string   `json:"username"`
+	Role        string   `json:"role"`
+	IsChirpyRed bool     `json:"is_chirpy_red"`
+	Chirps      []string `json:"chirps"`
+}
+
+type fixtures struct {
+	Users []fixtureUser `json:"users"`
+}
+
+// handlerReset wipes and optionally reseeds the database. The route needs an
+// admin on top of the dev-only check; test suites get their first admin
+// through ADMIN_EMAILS.
 func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
-	cfg.fileserverHits.Store(0)
+	type resetRequest struct {
+		Users         *bool `json:"users"`
+		Chirps        bool  `json:"chirps"`
+		RefreshTokens bool  `json:"refresh_tokens"`
+		Seed          bool  `json:"seed"`
+	}
 
-	err := cfg.db.DeleteUsers(r.Context())
+	if cfg.platform != "dev" {
+		respondWithError(w, 403, "Reset is only allowed in dev", nil)
+		return
+	}
+
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
 	if err != nil {
-		respondWithError(w, 400, "Error deleting users", err)
+		respondWithError(w, 500, "Error reading request body", err)
 		return
 	}
+
+	rq := resetRequest{}
+	if len(data) > 0 {
+		err = json.Unmarshal(data, &rq)
+		if err != nil {
+			respondWithError(w, 400, "Error unmarshaling json", err)
+			return
+		}
+	}
+	deleteUsers := rq.Users == nil || *rq.Users
+
+	cfg.fileserverHits.Store(0)
+	done := []string{"hits reset to 0"}
+
+	if rq.RefreshTokens {
+		err = cfg.db.DeleteRefreshTokens(r.Context())
+		if err != nil {
+			respondWithError(w, 400, "Error deleting refresh tokens", err)
+			return
+		}
+		done = append(done, "refresh tokens deleted")
+	}
+	if rq.Chirps {
+		err = cfg.db.DeleteChirps(r.Context())
+		if err != nil {
+			respondWithError(w, 400, "Error deleting chirps", err)
+			return
+		}
+		done = append(done, "chirps deleted")
+	}
+	if deleteUsers {
+		err = cfg.db.DeleteUsers(r.Context())
+		if err != nil {
+			respondWithError(w, 400, "Error deleting users", err)
+			return
+		}
+		err = cfg.db.DeleteLoginAttempts(r.Context())
+		if err != nil {
+			respondWithError(w, 400, "Error deleting login attempts", err)
+			return
+		}
+		done = append(done, "users deleted")
+	}
+	if rq.Seed {
+		if cfg.fixturesFile == "" {
+			respondWithError(w, 400, "FIXTURES_FILE is not configured", nil)
+			return
+		}
+		err = cfg.seedFixtures(r.Context(), cfg.fixturesFile)
+		if err != nil {
+			respondWithError(w, 400, "Error seeding fixtures", err)
+			return
+		}
+		done = append(done, "fixtures seeded")
+	}
+
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Hits reset to 0 and users deleted"))
+	w.Write([]byte(strings.Join(done, ", ")))
+}
+
+func (cfg *apiConfig) seedFixtures(ctx context.Context, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	fx := fixtures{}
+	err = json.Unmarshal(data, &fx)
+	if err != nil {
+		return err
+	}
+
+	for _, fu := range fx.Users {
+		hashedPassword, err := auth.HashPassword(fu.Password)
+		if err != nil {
+			return fmt.Errorf("hashing password for %s: %w", fu.Email, err)
+		}
+		user, err := cfg.db.CreateUser(ctx, database.CreateUserParams{
+			Email:          fu.Email,
+			HashedPassword: hashedPassword,
+			Username:       sql.NullString{String: fu.Username, Valid: fu.Username != ""},
+		})
+		if err != nil {
+			return fmt.Errorf("creating user %s: %w", fu.Email, err)
+		}
+		// Fixture accounts are usable straight away.
+		user, err = cfg.db.VerifyUserEmail(ctx, database.VerifyUserEmailParams{ID: user.ID, Email: user.Email})
+		if err != nil {
+			return fmt.Errorf("verifying user %s: %w", fu.Email, err)
+		}
+
+		if fu.Role != "" {
+			role, err := auth.ParseRole(fu.Role)
+			if err != nil {
+				return err
+			}
+			_, err = cfg.db.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: string(role)})
+			if err != nil {
+				return err
+			}
+		}
+		if fu.IsChirpyRed {
+			err = cfg.db.MarkUserRedById(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, body := range fu.Chirps {
+			chirp, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{Body: body, UserID: uuid.NullUUID{UUID: user.ID, Valid: true}})
+			if err != nil {
+				return fmt.Errorf("creating chirp for %s: %w", fu.Email, err)
+			}
+			err = indexChirpEntities(ctx, cfg.db, chirp)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
@@ -8,36 +8,208 @@ import (
 )
 
 type responseChirp struct {
+	ID         uuid.UUID     `json:"id"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	Body       string        `json:"body"`
+	UserID     uuid.NullUUID `json:"user_id"`
+	ParentID   uuid.NullUUID `json:"parent_id"`
+	Deleted    bool          `json:"deleted"`
+	Hidden     bool          `json:"hidden"`
+	LikeCount  int64         `json:"like_count"`
+	LikedByMe  bool          `json:"liked_by_me"`
+	ReplyCount int64         `json:"reply_count"`
+}
+
+func NewResponseChirp(chirp database.Chirp) *responseChirp {
+	return &responseChirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+		ParentID:  chirp.ParentID,
+		Deleted:   chirp.DeletedAt.Valid,
+		Hidden:    chirp.HiddenAt.Valid,
+	}
+}
+
+type responseChirpPage struct {
+	Chirps     []responseChirp `json:"chirps"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// newChirpPage expects chirps to be fetched with limit+1 rows so it can tell
+// whether another page follows.
+func newChirpPage(chirps []database.Chirp, limit int32) responseChirpPage {
+	page := responseChirpPage{Chirps: []responseChirp{}}
+	if len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, chr := range chirps {
+		page.Chirps = append(page.Chirps, *NewResponseChirp(chr))
+	}
+	return page
+}
+
+type responseChirpRevision struct {
 	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
 	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// responseChirpSearchResult.Snippet is HTML: the escaped chirp body with the
+// matched terms wrapped in <mark> tags.
+type responseChirpSearchResult struct {
+	responseChirp
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type responseModerationRule struct {
+	Word   string `json:"word"`
+	Action string `json:"action"`
+}
+
+type responseChirpFlag struct {
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	Words     []string  `json:"words"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type responseReport struct {
+	ID         uuid.UUID `json:"id"`
+	ChirpID    uuid.UUID `json:"chirp_id"`
+	ReporterID uuid.UUID `json:"reporter_id"`
+	Reason     string    `json:"reason"`
+	Details    string    `json:"details"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func NewResponseReport(report database.Report) *responseReport {
+	return &responseReport{
+		ID:         report.ID,
+		ChirpID:    report.ChirpID,
+		ReporterID: report.ReporterID,
+		Reason:     report.Reason,
+		Details:    report.Details,
+		Status:     report.Status,
+		CreatedAt:  report.CreatedAt,
+		UpdatedAt:  report.UpdatedAt,
+	}
 }
 
 type responseUser struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	Username      string    `json:"username"`
+	Role          string    `json:"role"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
 }
 
 func NewResponseUser(user database.User, token string, refreshToken string) *responseUser {
 	return &responseUser{
-		ID:           user.ID,
-		CreatedAt:    user.CreatedAt,
-		UpdatedAt:    user.UpdatedAt,
-		Email:        user.Email,
-		IsChirpyRed:  user.IsChirpyRed,
-		Token:        token,
-		RefreshToken: refreshToken,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		Username:      user.Username.String,
+		Role:          user.Role,
+		IsChirpyRed:   user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Token:         token,
+		RefreshToken:  refreshToken,
 	}
 }
 
+type responseFollow struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type responseProfile struct {
+	ID          uuid.UUID `json:"id"`
+	Username    string    `json:"username"`
+	CreatedAt   time.Time `json:"created_at"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ChirpCount  int64     `json:"chirp_count"`
+}
+
+type responseSession struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IpAddress  string    `json:"ip_address"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
 type requestUser struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Username string `json:"username"`
+}
+
+type responseMFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type responseReauth struct {
+	ReauthToken string `json:"reauth_token"`
+}
+
+type responseTOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type responseRecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type responseAPIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	Key        string     `json:"key,omitempty"`
+}
+
+func NewResponseAPIKey(apiKey database.ApiKey) *responseAPIKey {
+	rsKey := &responseAPIKey{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Scopes:    apiKey.Scopes,
+		CreatedAt: apiKey.CreatedAt,
+	}
+	if apiKey.LastUsedAt.Valid {
+		rsKey.LastUsedAt = &apiKey.LastUsedAt.Time
+	}
+	if apiKey.ExpiresAt.Valid {
+		rsKey.ExpiresAt = &apiKey.ExpiresAt.Time
+	}
+	return rsKey
+}
+
+type responseAccountDeletion struct {
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+type responseExportLike struct {
+	ChirpID uuid.UUID `json:"chirp_id"`
+	LikedAt time.Time `json:"liked_at"`
 }
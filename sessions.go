@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+// Sessions are refresh token families: the id of a session is its family id,
+// and the live token of the family carries the latest device details.
+
+func (cfg *apiConfig) handlerListSessions(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+
+	tokens, err := cfg.db.ListActiveSessions(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 400, "Error getting sessions", err)
+		return
+	}
+
+	respondWithJson(w, 200, newResponseSessions(tokens))
+}
+
+func newResponseSessions(tokens []database.RefreshToken) []responseSession {
+	sessions := make([]responseSession, len(tokens))
+	for i, tk := range tokens {
+		sessions[i] = responseSession{
+			ID:         tk.FamilyID,
+			UserAgent:  tk.UserAgent,
+			IpAddress:  tk.IpAddress,
+			LastUsedAt: tk.LastUsedAt,
+			ExpiresAt:  tk.ExpiresAt,
+		}
+	}
+	return sessions
+}
+
+func (cfg *apiConfig) handlerRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+	sessionId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+
+	revoked, err := cfg.db.RevokeSessionForUser(r.Context(), database.RevokeSessionForUserParams{FamilyID: sessionId, UserID: userId})
+	if err != nil {
+		respondWithError(w, 400, "Error revoking session", err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, 404, "Session doesn't exist", nil)
+		return
+	}
+	respondWithJson(w, 204, nil)
+}
+
+func (cfg *apiConfig) handlerLogoutAll(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+
+	// API keys go too, so a stolen session can't leave one behind.
+	err := cfg.withTx(r.Context(), func(q *database.Queries) error {
+		err := q.RevokeAllForUser(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		return q.RevokeAllAPIKeysForUser(r.Context(), userId)
+	})
+	if err != nil {
+		respondWithError(w, 400, "Error revoking sessions", err)
+		return
+	}
+	respondWithJson(w, 204, nil)
+}
+
+// clientIP returns the address of the client that made the request. When the
+// connection comes from one of TRUSTED_PROXIES, X-Forwarded-For is walked
+// from the right and the first address that isn't a trusted proxy is used, so
+// a client can't pick its own address by sending the header.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !cfg.isTrustedProxy(host) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !cfg.isTrustedProxy(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func (cfg *apiConfig) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range cfg.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies reads the comma-separated TRUSTED_PROXIES setting. Each
+// entry is an address or a CIDR range.
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,40 @@
+-- name: ScheduleAccountDeletion :one
+INSERT INTO account_deletions (user_id, requested_at, delete_after)
+VALUES ($1, NOW(), $2)
+ON CONFLICT (user_id) DO UPDATE
+SET delete_after = account_deletions.delete_after
+RETURNING *;
+
+-- name: CancelAccountDeletion :execrows
+DELETE FROM account_deletions
+WHERE user_id = $1;
+
+-- name: IsAccountPendingDeletion :one
+SELECT EXISTS (
+	SELECT 1 FROM account_deletions
+	WHERE user_id = $1
+);
+
+-- name: DeleteDueAccounts :execrows
+DELETE FROM users
+WHERE id IN (
+	SELECT user_id FROM account_deletions
+	WHERE delete_after <= NOW()
+);
+
+-- name: TombstoneDueAccountChirps :exec
+-- Detaches the chirps of accounts due for purging that have replies, so
+-- deleting the account doesn't orphan the replies, and drops the revisions
+-- that still hold their text.
+WITH tombstoned AS (
+	UPDATE chirps
+	SET user_id = NULL, body = '', deleted_at = COALESCE(deleted_at, NOW()), updated_at = NOW()
+	WHERE user_id IN (
+		SELECT user_id FROM account_deletions
+		WHERE delete_after <= NOW()
+	)
+	AND EXISTS (SELECT 1 FROM chirps AS replies WHERE replies.parent_id = chirps.id)
+	RETURNING id
+)
+DELETE FROM chirp_revisions
+WHERE chirp_id IN (SELECT id FROM tombstoned);
@@ -0,0 +1,25 @@
+-- name: LikeChirp :exec
+INSERT INTO chirp_likes (chirp_id, user_id, created_at)
+VALUES (
+	$1,
+	$2,
+	NOW()
+);
+
+-- name: UnlikeChirp :exec
+DELETE FROM chirp_likes
+WHERE chirp_id = $1 AND user_id = $2;
+
+-- name: GetChirpLikeStats :many
+SELECT chirp_id,
+	COUNT(*) AS like_count,
+	COALESCE(BOOL_OR(user_id = sqlc.narg('viewer_id')), false)::bool AS liked_by_me
+FROM chirp_likes
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+AND NOT EXISTS (SELECT 1 FROM account_deletions WHERE account_deletions.user_id = chirp_likes.user_id)
+GROUP BY chirp_id;
+
+-- name: ListLikesByUser :many
+SELECT * FROM chirp_likes
+WHERE user_id = $1
+ORDER BY created_at;
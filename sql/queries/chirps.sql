@@ -1,11 +1,12 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, parent_id)
 VALUES (
 	gen_random_uuid(),
 	NOW(),
 	NOW(),
 	$1,
-	$2
+	$2,
+	$3
 )
 RETURNING *;
 
@@ -23,3 +24,138 @@ WHERE id = $1;
 -- name: GetChirpsByAuthor :many
 SELECT * FROM chirps
 where user_id = $1;
+
+-- name: ListChirpsAsc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+AND (sqlc.narg('user_id')::uuid IS NULL OR user_id = sqlc.narg('user_id'))
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL OR (created_at, id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+AND (hidden_at IS NULL OR user_id = sqlc.narg('viewer_id'))
+AND NOT EXISTS (SELECT 1 FROM account_deletions WHERE account_deletions.user_id = chirps.user_id)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+AND (sqlc.narg('user_id')::uuid IS NULL OR user_id = sqlc.narg('user_id'))
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL OR (created_at, id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+AND (hidden_at IS NULL OR user_id = sqlc.narg('viewer_id'))
+AND NOT EXISTS (SELECT 1 FROM account_deletions WHERE account_deletions.user_id = chirps.user_id)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirps :many
+-- The body is HTML-escaped before highlighting so snippet is safe to render
+-- as HTML; only the <mark> tags added by ts_headline are markup.
+SELECT chirps.*,
+	ts_rank(search_vector, websearch_to_tsquery('english', sqlc.arg('query'))) AS rank,
+	ts_headline('english', replace(replace(replace(replace(replace(body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;'), websearch_to_tsquery('english', sqlc.arg('query')), 'StartSel=<mark>, StopSel=</mark>') AS snippet
+FROM chirps
+WHERE search_vector @@ websearch_to_tsquery('english', sqlc.arg('query'))
+AND hidden_at IS NULL
+AND NOT EXISTS (SELECT 1 FROM account_deletions WHERE account_deletions.user_id = chirps.user_id)
+AND (sqlc.narg('user_id')::uuid IS NULL OR user_id = sqlc.narg('user_id'))
+ORDER BY
+	CASE WHEN sqlc.arg('sort')::text = 'asc' THEN created_at END ASC,
+	CASE WHEN sqlc.arg('sort')::text = 'desc' THEN created_at END DESC,
+	rank DESC,
+	id
+LIMIT sqlc.arg('limit');
+
+-- name: ListTimelineChirps :many
+SELECT chirps.* FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg('follower_id')
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND NOT EXISTS (SELECT 1 FROM account_deletions WHERE account_deletions.user_id = chirps.user_id)
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpReplies :many
+SELECT * FROM chirps
+WHERE parent_id = sqlc.arg('parent_id')
+AND hidden_at IS NULL
+AND NOT EXISTS (SELECT 1 FROM account_deletions WHERE account_deletions.user_id = chirps.user_id)
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL OR (created_at, id) > (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: GetChirpReplyCounts :many
+SELECT parent_id, COUNT(*) AS reply_count
+FROM chirps
+WHERE parent_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+AND NOT EXISTS (SELECT 1 FROM account_deletions WHERE account_deletions.user_id = chirps.user_id)
+GROUP BY parent_id;
+
+-- name: LockChirpById :exec
+SELECT id FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
+-- name: CountChirpReplies :one
+SELECT COUNT(*) FROM chirps
+WHERE parent_id = $1;
+
+-- name: TombstoneChirpById :exec
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: UpdateChirpBody :one
+WITH revision AS (
+	INSERT INTO chirp_revisions (id, chirp_id, body, created_at)
+	SELECT gen_random_uuid(), chirps.id, chirps.body, chirps.updated_at
+	FROM chirps
+	WHERE chirps.id = $1
+)
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: ListChirpsByTag :many
+SELECT chirps.* FROM chirps
+JOIN chirp_tags ON chirp_tags.chirp_id = chirps.id
+WHERE chirp_tags.tag = sqlc.arg('tag')
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND NOT EXISTS (SELECT 1 FROM account_deletions WHERE account_deletions.user_id = chirps.user_id)
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListMentionChirps :many
+SELECT chirps.* FROM chirps
+JOIN chirp_mentions ON chirp_mentions.chirp_id = chirps.id
+WHERE chirp_mentions.user_id = sqlc.arg('user_id')
+AND chirps.deleted_at IS NULL
+AND chirps.hidden_at IS NULL
+AND NOT EXISTS (SELECT 1 FROM account_deletions WHERE account_deletions.user_id = chirps.user_id)
+AND (sqlc.narg('cursor_created_at')::timestamp IS NULL OR (chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at'), sqlc.narg('cursor_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: CountChirpsByAuthor :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND hidden_at IS NULL;
+
+-- name: HideChirpById :exec
+UPDATE chirps
+SET hidden_at = NOW()
+WHERE id = $1;
+
+-- name: UnhideChirpById :exec
+UPDATE chirps
+SET hidden_at = NULL
+WHERE id = $1;
+
+-- name: DeleteChirps :exec
+DELETE FROM chirps;
+
+-- name: ListChirpsForExport :many
+SELECT * FROM chirps
+WHERE user_id = $1
+ORDER BY created_at, id;
@@ -0,0 +1,26 @@
+-- name: GetLoginLockouts :many
+SELECT * FROM login_attempts
+WHERE key = ANY(sqlc.arg(keys)::text[]) AND locked_until > NOW();
+
+-- name: RecordFailedLogin :one
+INSERT INTO login_attempts (key, failed_count, last_failed_at)
+VALUES (sqlc.arg(key), 1, NOW())
+ON CONFLICT (key) DO UPDATE
+SET failed_count = CASE
+		WHEN login_attempts.last_failed_at < sqlc.arg(window_start) THEN 1
+		ELSE login_attempts.failed_count + 1
+	END,
+	last_failed_at = NOW()
+RETURNING *;
+
+-- name: LockLogin :exec
+UPDATE login_attempts
+SET locked_until = $2
+WHERE key = $1;
+
+-- name: ClearLoginAttempts :exec
+DELETE FROM login_attempts
+WHERE key = $1;
+
+-- name: DeleteLoginAttempts :exec
+DELETE FROM login_attempts;
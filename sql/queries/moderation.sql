@@ -0,0 +1,33 @@
+-- name: GetModerationRules :many
+SELECT * FROM moderation_rules
+ORDER BY word;
+
+-- name: UpsertModerationRule :one
+INSERT INTO moderation_rules (word, action, created_at, updated_at)
+VALUES (
+	$1,
+	$2,
+	NOW(),
+	NOW()
+)
+ON CONFLICT (word) DO UPDATE
+SET action = EXCLUDED.action, updated_at = NOW()
+RETURNING *;
+
+-- name: DeleteModerationRule :execrows
+DELETE FROM moderation_rules
+WHERE word = $1;
+
+-- name: FlagChirp :exec
+INSERT INTO chirp_flags (chirp_id, words, created_at)
+VALUES (
+	$1,
+	$2,
+	NOW()
+)
+ON CONFLICT (chirp_id) DO UPDATE
+SET words = EXCLUDED.words, created_at = NOW();
+
+-- name: GetChirpFlags :many
+SELECT * FROM chirp_flags
+ORDER BY created_at DESC;
@@ -1,24 +1,64 @@
 -- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens (
-	token,
+	token_hash,
 	created_at,
 	updated_at,
 	user_id,
 	expires_at,
-	revoked_at 
+	revoked_at,
+	family_id,
+	user_agent,
+	ip_address,
+	last_used_at,
+	family_created_at
 ) VALUES (
 	$1,
 	NOW(),
 	NOW(),
 	$2,
 	$3,
-	NULL
+	NULL,
+	$4,
+	$5,
+	$6,
+	NOW(),
+	$7
 )
 RETURNING *;
+
 -- name: GetRefreshToken :one
 SELECT * FROM refresh_tokens
-WHERE token = $1;
+WHERE token_hash = $1;
+
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens 
 SET revoked_at = NOW()
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: DeleteRefreshTokens :exec
+DELETE FROM refresh_tokens;
+
+-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET rotated_at = NOW(), updated_at = NOW(), last_used_at = NOW()
+WHERE token_hash = $1 AND rotated_at IS NULL AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: ListActiveSessions :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND rotated_at IS NULL AND expires_at > NOW()
+ORDER BY last_used_at DESC;
+
+-- name: RevokeSessionForUser :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllForUser :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
@@ -0,0 +1,29 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, chirp_id, reporter_id, reason, details, status, created_at, updated_at)
+VALUES (
+	gen_random_uuid(),
+	$1,
+	$2,
+	$3,
+	$4,
+	'open',
+	NOW(),
+	NOW()
+)
+RETURNING *;
+
+-- name: ListReports :many
+SELECT * FROM reports
+WHERE (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status'))
+ORDER BY created_at ASC;
+
+-- name: UpdateReportStatus :one
+UPDATE reports
+SET status = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: ResolveChirpReports :exec
+UPDATE reports
+SET status = 'actioned', updated_at = NOW()
+WHERE chirp_id = $1 AND status = 'open';
@@ -1,11 +1,12 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, username)
 VALUES (
 	gen_random_uuid(),
 	NOW(),
 	NOW(),
 	$1,
-	$2
+	$2,
+	$3
 )
 RETURNING *;
 
@@ -20,3 +21,45 @@ WHERE email = $1 LIMIT 1;
 UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1;
+
+-- name: GetUserById :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: UpdateUser :one
+UPDATE users
+SET email = $2,
+	hashed_password = $3,
+	username = $4,
+	email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END,
+	updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserByUsername :one
+SELECT * FROM users
+WHERE lower(username) = lower($1);
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: PromoteUsersByEmail :execrows
+UPDATE users
+SET role = 'admin', updated_at = NOW()
+WHERE lower(email) = ANY(sqlc.arg('emails')::text[])
+AND email_verified_at IS NOT NULL
+AND role <> 'admin';
+
+-- name: SetUserPasswordHash :exec
+UPDATE users
+SET hashed_password = $2
+WHERE id = $1;
+
+-- name: VerifyUserEmail :one
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+RETURNING *;
@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE moderation_rules(
+	word TEXT PRIMARY KEY,
+	action TEXT NOT NULL CHECK (action IN ('mask', 'reject', 'flag')),
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO moderation_rules (word, action, created_at, updated_at)
+VALUES
+	('kerfuffle', 'mask', NOW(), NOW()),
+	('sharbert', 'mask', NOW(), NOW()),
+	('fornax', 'mask', NOW(), NOW());
+
+CREATE TABLE chirp_flags(
+	chirp_id UUID PRIMARY KEY,
+	words TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE chirp_flags;
+DROP TABLE moderation_rules;
@@ -0,0 +1,25 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN hidden_at TIMESTAMP;
+
+CREATE TABLE reports(
+	id UUID PRIMARY KEY,
+	chirp_id UUID NOT NULL,
+	reporter_id UUID NOT NULL,
+	reason TEXT NOT NULL CHECK (reason IN ('spam', 'harassment', 'hate', 'misinformation', 'other')),
+	details TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'dismissed', 'actioned')),
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	UNIQUE (chirp_id, reporter_id),
+	FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+	FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX reports_status_created_at_idx ON reports (status, created_at);
+
+-- +goose Down
+DROP TABLE reports;
+
+ALTER TABLE chirps
+DROP COLUMN hidden_at;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE account_deletions (
+	user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	requested_at TIMESTAMP NOT NULL,
+	delete_after TIMESTAMP NOT NULL
+);
+
+CREATE INDEX account_deletions_delete_after_idx ON account_deletions (delete_after);
+
+-- +goose Down
+DROP TABLE account_deletions;
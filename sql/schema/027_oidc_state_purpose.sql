@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE oidc_states
+ADD COLUMN purpose TEXT NOT NULL DEFAULT 'login' CHECK (purpose IN ('login', 'reauth'));
+
+-- +goose Down
+ALTER TABLE oidc_states
+DROP COLUMN purpose;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- Every token in a family carries when the family started, so rotation can't
+-- extend a session past its absolute lifetime.
+ALTER TABLE refresh_tokens
+ADD COLUMN family_created_at TIMESTAMP;
+
+UPDATE refresh_tokens
+SET family_created_at = families.created_at
+FROM (
+	SELECT family_id, MIN(created_at) AS created_at
+	FROM refresh_tokens
+	GROUP BY family_id
+) AS families
+WHERE refresh_tokens.family_id = families.family_id;
+
+ALTER TABLE refresh_tokens
+ALTER COLUMN family_created_at SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN family_created_at;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- NULL keeps the key valid until it is revoked.
+ALTER TABLE api_keys
+ADD COLUMN expires_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE api_keys
+DROP COLUMN expires_at;
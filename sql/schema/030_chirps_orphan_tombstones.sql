@@ -0,0 +1,12 @@
+-- +goose Up
+-- Purging an account keeps its chirps that have replies as tombstones with no
+-- author, so the threads under them stay intact.
+ALTER TABLE chirps
+ALTER COLUMN user_id DROP NOT NULL;
+
+-- +goose Down
+DELETE FROM chirps
+WHERE user_id IS NULL;
+
+ALTER TABLE chirps
+ALTER COLUMN user_id SET NOT NULL;
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+var (
+	hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_#])#([\p{L}\p{N}_]+)`)
+	mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.+-]+@[\w-]+(?:\.[\w-]+)+|\w+)`)
+)
+
+func extractHashtags(body string) []string {
+	return extractNormalized(hashtagPattern, body)
+}
+
+func extractMentions(body string) []string {
+	return extractNormalized(mentionPattern, body)
+}
+
+func extractNormalized(pattern *regexp.Regexp, body string) []string {
+	seen := map[string]struct{}{}
+	found := []string{}
+	for _, match := range pattern.FindAllStringSubmatch(body, -1) {
+		value := strings.ToLower(match[1])
+		if _, ok := seen[value]; ok {
+			continue
+		}
+		seen[value] = struct{}{}
+		found = append(found, value)
+	}
+	return found
+}
+
+// indexChirpEntities replaces the stored hashtags and mentions of a chirp with
+// the ones found in its current body. Callers pass the queries of the
+// transaction that wrote the chirp so the body and its index change together.
+func indexChirpEntities(ctx context.Context, q *database.Queries, chirp database.Chirp) error {
+	err := q.DeleteChirpTags(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+	err = q.DeleteChirpMentions(ctx, chirp.ID)
+	if err != nil {
+		return err
+	}
+
+	if tags := extractHashtags(chirp.Body); len(tags) > 0 {
+		err = q.AddChirpTags(ctx, database.AddChirpTagsParams{ChirpID: chirp.ID, Tags: tags})
+		if err != nil {
+			return err
+		}
+	}
+	if handles := extractMentions(chirp.Body); len(handles) > 0 {
+		err = q.AddChirpMentions(ctx, database.AddChirpMentionsParams{ChirpID: chirp.ID, Handles: handles})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerGetTagChirps(w http.ResponseWriter, r *http.Request) {
+	tag := strings.ToLower(strings.TrimPrefix(r.PathValue("tag"), "#"))
+	if tag == "" {
+		respondWithError(w, 400, "Tag is required", nil)
+		return
+	}
+
+	limit, err := parsePageLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid limit", err)
+		return
+	}
+
+	params := database.ListChirpsByTagParams{Tag: tag, Limit: limit + 1}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		pc, err := decodeCursor(cursor)
+		if err != nil {
+			respondWithError(w, 400, "Invalid cursor", err)
+			return
+		}
+		params.CursorCreatedAt = pc.nullTime()
+		params.CursorID = pc.nullID()
+	}
+
+	chirps, err := cfg.db.ListChirpsByTag(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 400, "Error getting chirps", err)
+		return
+	}
+
+	page := newChirpPage(chirps, limit)
+	err = cfg.attachChirpStats(r.Context(), page.Chirps, viewerIdFromContext(r.Context()))
+	if err != nil {
+		respondWithError(w, 400, "Error getting chirp stats", err)
+		return
+	}
+	respondWithJson(w, 200, page)
+}
+
+func (cfg *apiConfig) handlerGetMentions(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+
+	limit, err := parsePageLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid limit", err)
+		return
+	}
+
+	params := database.ListMentionChirpsParams{UserID: userId, Limit: limit + 1}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		pc, err := decodeCursor(cursor)
+		if err != nil {
+			respondWithError(w, 400, "Invalid cursor", err)
+			return
+		}
+		params.CursorCreatedAt = pc.nullTime()
+		params.CursorID = pc.nullID()
+	}
+
+	chirps, err := cfg.db.ListMentionChirps(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 400, "Error getting mentions", err)
+		return
+	}
+
+	page := newChirpPage(chirps, limit)
+	err = cfg.attachChirpStats(r.Context(), page.Chirps, uuid.NullUUID{UUID: userId, Valid: true})
+	if err != nil {
+		respondWithError(w, 400, "Error getting chirp stats", err)
+		return
+	}
+	respondWithJson(w, 200, page)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "none", body: "no tags here", want: []string{}},
+		{name: "single", body: "learning #golang today", want: []string{"golang"}},
+		{name: "start of body", body: "#chirpy rocks", want: []string{"chirpy"}},
+		{name: "lowercased and deduplicated", body: "#Go and #go and #GO", want: []string{"go"}},
+		{name: "keeps order", body: "#b #a #b", want: []string{"b", "a"}},
+		{name: "unicode", body: "café #crème_brûlée", want: []string{"crème_brûlée"}},
+		{name: "stops at punctuation", body: "#tag, #other!", want: []string{"tag", "other"}},
+		{name: "inside word", body: "issue#42 and a#b", want: []string{}},
+		{name: "doubled hash", body: "##notatag", want: []string{}},
+		{name: "bare hash", body: "# alone", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractHashtags(tt.body)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractHashtags(%q) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{name: "none", body: "nobody here", want: []string{}},
+		{name: "username", body: "hi @alice", want: []string{"alice"}},
+		{name: "start of body", body: "@bob hello", want: []string{"bob"}},
+		{name: "email handle", body: "ping @Carol@Example.com please", want: []string{"carol@example.com"}},
+		{name: "plain email is not a mention", body: "mail dave@example.com", want: []string{}},
+		{name: "lowercased and deduplicated", body: "@Eve @eve @EVE", want: []string{"eve"}},
+		{name: "several", body: "@a, @b and @c.", want: []string{"a", "b", "c"}},
+		{name: "bare at", body: "meet @ noon", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractMentions(tt.body)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractMentions(%q) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
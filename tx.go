@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+
+	"github.com/mikarwacki/chirpy/internal/database"
+)
+
+// withTx runs fn against queries bound to a single transaction, committing
+// when fn succeeds and rolling back otherwise.
+func (cfg *apiConfig) withTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := cfg.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(cfg.db.WithTx(tx))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -1,16 +1,34 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/mikarwacki/chirpy/internal/auth"
 	"github.com/mikarwacki/chirpy/internal/database"
 )
 
+// Each refresh token lives for refreshTokenTTL, but rotation never extends a
+// session past refreshFamilyMaxAge from the original login.
+const (
+	refreshTokenTTL     = 60 * 24 * time.Hour
+	refreshFamilyMaxAge = 180 * 24 * time.Hour
+)
+
+var errRefreshTokenReused = errors.New("refresh token already rotated")
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
 func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	data, err := io.ReadAll(r.Body)
@@ -26,6 +44,17 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if u.Username != "" && !usernamePattern.MatchString(u.Username) {
+		respondWithError(w, 400, "Username must be 3-30 letters, digits or underscores", nil)
+		return
+	}
+
+	err = cfg.passwordPolicy.Validate(u.Password)
+	if err != nil {
+		respondWithError(w, 422, err.Error(), nil)
+		return
+	}
+
 	hashedPassword, err := auth.HashPassword(u.Password)
 	if err != nil {
 		log.Printf("Error hashing password: %v\n", err)
@@ -33,15 +62,25 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	createUserParams := database.CreateUserParams{Email: u.Email, HashedPassword: hashedPassword}
+	createUserParams := database.CreateUserParams{
+		Email:          u.Email,
+		HashedPassword: hashedPassword,
+		Username:       sql.NullString{String: u.Username, Valid: u.Username != ""},
+	}
 	us, err := cfg.db.CreateUser(r.Context(), createUserParams)
 	if err != nil {
 		log.Printf("Failed creating user: %v\n", err)
+		if isUniqueViolation(err) {
+			respondWithError(w, 409, userConflictMessage(err), err)
+			return
+		}
 		respondWithError(w, 400, "Error reading from db", err)
 		return
 	}
 
-	rUser := responseUser{ID: us.ID, CreatedAt: us.CreatedAt, UpdatedAt: us.UpdatedAt, Email: us.Email}
+	cfg.queueVerificationEmail(us)
+
+	rUser := responseUser{ID: us.ID, CreatedAt: us.CreatedAt, UpdatedAt: us.UpdatedAt, Email: us.Email, Username: us.Username.String}
 	respondWithJson(w, 201, rUser)
 }
 
@@ -60,70 +99,207 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	keys := cfg.loginKeys(r, rqUser.Email)
+	lockedUntil, err := cfg.loginLockedUntil(r.Context(), keys)
+	if err != nil {
+		respondWithError(w, 500, "Error checking login attempts", err)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		respondLoginLocked(w, lockedUntil)
+		return
+	}
+
 	user, err := cfg.db.GetUserByEmail(r.Context(), rqUser.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		auth.CheckPasswordMissingUser(rqUser.Password)
+		cfg.recordFailedLogin(r.Context(), keys)
+		respondWithError(w, 401, "Incorrect email or password", err)
+		return
+	}
 	if err != nil {
-		log.Printf("Error fetching: %v", err)
-		respondWithError(w, 400, "Error fetching database", err)
+		respondWithError(w, 500, "Error fetching database", err)
 		return
 	}
 
 	err = auth.CheckPasswordHash(rqUser.Password, user.HashedPassword)
 	if err != nil {
+		cfg.recordFailedLogin(r.Context(), keys)
 		respondWithError(w, 401, "Incorrect email or password", err)
 		return
 	}
+	if auth.NeedsRehash(user.HashedPassword) {
+		cfg.rehashPassword(r.Context(), user.ID, rqUser.Password)
+	}
+	cfg.respondWithLoginOrChallenge(w, r, user)
+}
+
+// respondWithLoginOrChallenge completes the first login step: users with TOTP
+// enabled get an MFA challenge to finish at /api/login/mfa instead of tokens.
+func (cfg *apiConfig) respondWithLoginOrChallenge(w http.ResponseWriter, r *http.Request, user database.User) {
+	totp, err := cfg.db.GetUserTOTP(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 500, "Error fetching database", err)
+		return
+	}
+	if err == nil && totp.EnabledAt.Valid {
+		challenge, err := auth.MakeMFAChallengeToken(user.ID, cfg.jwtKeys, mfaChallengeTTL)
+		if err != nil {
+			respondWithError(w, 400, "Error making mfa token", err)
+			return
+		}
+		respondWithJson(w, 200, responseMFAChallenge{MFARequired: true, MFAToken: challenge})
+		return
+	}
+
+	cfg.respondWithLogin(w, r, user)
+}
+
+// respondWithLogin issues an access token and starts a new session. It runs
+// once every login step has passed, so this is where the account's failed
+// login counter is cleared. Only the account counter is cleared; the address
+// counter decays on its own so logging into one account doesn't reset
+// guessing at others.
+func (cfg *apiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	cfg.cancelAccountDeletion(r.Context(), user.ID)
+	err := cfg.db.ClearLoginAttempts(r.Context(), accountLoginKey(user.Email))
+	if err != nil {
+		log.Printf("Error clearing login attempts: %v", err)
+	}
 
 	refresh := time.Hour
-	token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, refresh)
+	token, err := auth.MakeJWT(user.ID, auth.Role(user.Role), cfg.jwtKeys, refresh)
 	if err != nil {
 		respondWithError(w, 400, "Error making jwt token", err)
 		return
 	}
-	refreshToken, err := auth.MakeRefreshToken()
+	refreshToken, err := cfg.issueRefreshToken(r, cfg.db, user.ID, uuid.New(), time.Now())
 	if err != nil {
 		respondWithError(w, 400, "Error creating refresh token", err)
 		return
 	}
-	newToken := database.CreateRefreshTokenParams{
-		Token:     refreshToken,
-		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(time.Hour * 24 * 60),
-	}
-	_, err = cfg.db.CreateRefreshToken(r.Context(), newToken)
-	if err != nil {
-		respondWithError(w, 400, "Error saving refresh token", err)
-		return
-	}
 
 	rsUser := *NewResponseUser(user, token, refreshToken)
 	respondWithJson(w, 200, rsUser)
 }
 
+// rehashPassword upgrades a hash made with an outdated bcrypt cost while the
+// plaintext is at hand. Failing to do so doesn't fail the login.
+func (cfg *apiConfig) rehashPassword(ctx context.Context, userId uuid.UUID, password string) {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Error rehashing password for user %v: %v", userId, err)
+		return
+	}
+	err = cfg.db.SetUserPasswordHash(ctx, database.SetUserPasswordHashParams{ID: userId, HashedPassword: hashedPassword})
+	if err != nil {
+		log.Printf("Error storing rehashed password for user %v: %v", userId, err)
+	}
+}
+
+// handlerRefresh exchanges a refresh token for a new access token and a new
+// refresh token in the same family. Presenting a token that was already
+// rotated means it leaked, so the whole family is revoked.
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	token, err := auth.GetBearerToken(r.Header)
-	log.Printf("TOKEN: %v\n", token)
 	if err != nil {
 		respondWithError(w, 400, "Token not present in a header", err)
 		return
 	}
-	dbToken, err := cfg.db.GetRefreshToken(r.Context(), token)
+	dbToken, err := cfg.db.GetRefreshToken(r.Context(), auth.HashToken(token))
 	if err != nil {
 		log.Printf("Database error: %v", err)
 		respondWithError(w, 401, "Unautharized", err)
 		return
 	}
 
+	if dbToken.RotatedAt.Valid {
+		cfg.revokeRefreshTokenFamily(r.Context(), dbToken)
+		respondWithError(w, 401, "Unautharized", nil)
+		return
+	}
 	if dbToken.ExpiresAt.Before(time.Now()) || dbToken.RevokedAt.Valid {
 		log.Println("Token is expired")
 		respondWithError(w, 401, "Unautharized", err)
 		return
 	}
-	newToken, err := auth.MakeJWT(dbToken.UserID, cfg.jwtSecret, time.Hour)
+
+	user, err := cfg.db.GetUserById(r.Context(), dbToken.UserID)
+	if err != nil {
+		respondWithError(w, 401, "Unautharized", err)
+		return
+	}
+	newToken, err := auth.MakeJWT(user.ID, auth.Role(user.Role), cfg.jwtKeys, time.Hour)
 	if err != nil {
 		respondWithError(w, 400, "Error refreshing access token", err)
 		return
 	}
-	respondWithJson(w, 200, map[string]string{"token": newToken})
+
+	// The old token is only spent once its replacement is stored, so a failed
+	// refresh can be retried without looking like reuse.
+	var newRefreshToken string
+	err = cfg.withTx(r.Context(), func(q *database.Queries) error {
+		rotated, err := q.RotateRefreshToken(r.Context(), auth.HashToken(token))
+		if err != nil {
+			return err
+		}
+		if rotated == 0 {
+			return errRefreshTokenReused
+		}
+		newRefreshToken, err = cfg.issueRefreshToken(r, q, user.ID, dbToken.FamilyID, dbToken.FamilyCreatedAt)
+		return err
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		// Lost a race against another refresh with the same token.
+		cfg.revokeRefreshTokenFamily(r.Context(), dbToken)
+		respondWithError(w, 401, "Unautharized", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, 400, "Error rotating refresh token", err)
+		return
+	}
+	respondWithJson(w, 200, map[string]string{"token": newToken, "refresh_token": newRefreshToken})
+}
+
+// issueRefreshToken stores a new refresh token in the given family, recording
+// the device the request came from so it shows up in the session list.
+func (cfg *apiConfig) issueRefreshToken(r *http.Request, q *database.Queries, userId, familyId uuid.UUID, familyCreatedAt time.Time) (string, error) {
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	newToken := database.CreateRefreshTokenParams{
+		TokenHash:       auth.HashToken(refreshToken),
+		UserID:          userId,
+		ExpiresAt:       refreshTokenExpiry(time.Now(), familyCreatedAt),
+		FamilyID:        familyId,
+		UserAgent:       r.UserAgent(),
+		IpAddress:       cfg.clientIP(r),
+		FamilyCreatedAt: familyCreatedAt,
+	}
+	_, err = q.CreateRefreshToken(r.Context(), newToken)
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// refreshTokenExpiry caps a new token's lifetime at the end of its family's.
+func refreshTokenExpiry(now, familyCreatedAt time.Time) time.Time {
+	expiresAt := now.Add(refreshTokenTTL)
+	if familyEnd := familyCreatedAt.Add(refreshFamilyMaxAge); familyEnd.Before(expiresAt) {
+		return familyEnd
+	}
+	return expiresAt
+}
+
+func (cfg *apiConfig) revokeRefreshTokenFamily(ctx context.Context, dbToken database.RefreshToken) {
+	log.Printf("Refresh token reuse detected for user %v, revoking family %v", dbToken.UserID, dbToken.FamilyID)
+	err := cfg.db.RevokeRefreshTokenFamily(ctx, dbToken.FamilyID)
+	if err != nil {
+		log.Printf("Error revoking refresh token family %v: %v", dbToken.FamilyID, err)
+	}
 }
 
 func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
@@ -132,7 +308,7 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, 400, "Bearer token missing from the header", err)
 		return
 	}
-	err = cfg.db.RevokeRefreshToken(r.Context(), token)
+	err = cfg.db.RevokeRefreshToken(r.Context(), auth.HashToken(token))
 	if err != nil {
 		respondWithError(w, 400, "Error revoking token", err)
 		return
@@ -141,5 +317,208 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 }
 
 func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 500, "Error reading request body", err)
+		return
+	}
+
+	rqUser := requestUser{}
+	err = json.Unmarshal(data, &rqUser)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshaling json", err)
+		return
+	}
+	if rqUser.Email == "" && rqUser.Password == "" && rqUser.Username == "" {
+		respondWithError(w, 400, "Email, password or username required", nil)
+		return
+	}
+	if rqUser.Username != "" && !usernamePattern.MatchString(rqUser.Username) {
+		respondWithError(w, 400, "Username must be 3-30 letters, digits or underscores", nil)
+		return
+	}
+
+	user, err := cfg.db.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 404, "User doesn't exist", err)
+		return
+	}
+
+	updateUserParams := database.UpdateUserParams{ID: user.ID, Email: user.Email, HashedPassword: user.HashedPassword, Username: user.Username}
+	if rqUser.Email != "" {
+		updateUserParams.Email = rqUser.Email
+	}
+	if rqUser.Username != "" {
+		updateUserParams.Username = sql.NullString{String: rqUser.Username, Valid: true}
+	}
+	if rqUser.Password != "" {
+		err = cfg.passwordPolicy.Validate(rqUser.Password)
+		if err != nil {
+			respondWithError(w, 422, err.Error(), nil)
+			return
+		}
+		hashedPassword, err := auth.HashPassword(rqUser.Password)
+		if err != nil {
+			respondWithError(w, 400, "Error hashing password", err)
+			return
+		}
+		updateUserParams.HashedPassword = hashedPassword
+	}
+
+	us, err := cfg.db.UpdateUser(r.Context(), updateUserParams)
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, 409, userConflictMessage(err), err)
+			return
+		}
+		respondWithError(w, 400, "Error updating user", err)
+		return
+	}
+
+	if us.Email != user.Email {
+		cfg.queueVerificationEmail(us)
+	}
+
+	rsUser := *NewResponseUser(us, "", "")
+	respondWithJson(w, 200, rsUser)
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func userConflictMessage(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Constraint == "users_username_lower_idx" {
+		return "Username already taken"
+	}
+	return "Email already in use"
+}
+
+func (cfg *apiConfig) handlerGetMe(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+
+	user, err := cfg.db.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 404, "User doesn't exist", err)
+		return
+	}
+	respondWithJson(w, 200, *NewResponseUser(user, "", ""))
+}
+
+func (cfg *apiConfig) handlerGetUserProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.db.GetUserByUsername(r.Context(), r.PathValue("username"))
+	if err != nil {
+		respondWithError(w, 404, "User doesn't exist", err)
+		return
+	}
+	pending, err := cfg.db.IsAccountPendingDeletion(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 400, "Error fetching database", err)
+		return
+	}
+	if pending {
+		respondWithError(w, 404, "User doesn't exist", nil)
+		return
+	}
 
+	chirpCount, err := cfg.db.CountChirpsByAuthor(r.Context(), uuid.NullUUID{UUID: user.ID, Valid: true})
+	if err != nil {
+		respondWithError(w, 400, "Error counting chirps", err)
+		return
+	}
+
+	profile := responseProfile{
+		ID:          user.ID,
+		Username:    user.Username.String,
+		CreatedAt:   user.CreatedAt,
+		IsChirpyRed: user.IsChirpyRed,
+		ChirpCount:  chirpCount,
+	}
+	respondWithJson(w, 200, profile)
+}
+
+// resolveAuthorId accepts either a user id or a username.
+func (cfg *apiConfig) resolveAuthorId(ctx context.Context, author string) (uuid.UUID, error) {
+	if id, err := uuid.Parse(author); err == nil {
+		return id, nil
+	}
+	user, err := cfg.db.GetUserByUsername(ctx, author)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return user.ID, nil
+}
+
+// parseAdminEmails splits the comma-separated ADMIN_EMAILS setting into
+// lowercased addresses.
+func parseAdminEmails(value string) []string {
+	emails := []string{}
+	for _, email := range strings.Split(value, ",") {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+// bootstrapAdmins gives the admin role to the verified accounts listed in
+// ADMIN_EMAILS, so a fresh deployment has someone who can assign roles through
+// PUT /admin/users/{id}/role. Accounts that verify their email later are
+// promoted by handlerVerifyEmail.
+func (cfg *apiConfig) bootstrapAdmins(ctx context.Context) error {
+	if len(cfg.adminEmails) == 0 {
+		return nil
+	}
+	promoted, err := cfg.db.PromoteUsersByEmail(ctx, cfg.adminEmails)
+	if err != nil {
+		return err
+	}
+	if promoted > 0 {
+		log.Printf("Promoted %d account(s) from ADMIN_EMAILS to admin", promoted)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handlerSetUserRole(w http.ResponseWriter, r *http.Request) {
+	type roleRequest struct {
+		Role string `json:"role"`
+	}
+
+	userId, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Error parsing uuid", err)
+		return
+	}
+
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 500, "Error reading request body", err)
+		return
+	}
+
+	rq := roleRequest{}
+	err = json.Unmarshal(data, &rq)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshaling json", err)
+		return
+	}
+	role, err := auth.ParseRole(rq.Role)
+	if err != nil {
+		respondWithError(w, 400, "Role must be user, moderator or admin", err)
+		return
+	}
+
+	user, err := cfg.db.SetUserRole(r.Context(), database.SetUserRoleParams{ID: userId, Role: string(role)})
+	if err != nil {
+		respondWithError(w, 404, "User doesn't exist", err)
+		return
+	}
+	respondWithJson(w, 200, *NewResponseUser(user, "", ""))
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseAdminEmails(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{name: "unset", value: "", want: []string{}},
+		{name: "single", value: "root@example.com", want: []string{"root@example.com"}},
+		{name: "trims and lowercases", value: " Root@Example.com , ops@example.com", want: []string{"root@example.com", "ops@example.com"}},
+		{name: "skips empty entries", value: "a@example.com,,b@example.com,", want: []string{"a@example.com", "b@example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseAdminEmails(tt.value)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAdminEmails(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name            string
+		familyCreatedAt time.Time
+		want            time.Time
+	}{
+		{name: "new family", familyCreatedAt: now, want: now.Add(refreshTokenTTL)},
+		{name: "capped by family age", familyCreatedAt: now.Add(-refreshFamilyMaxAge + time.Hour), want: now.Add(time.Hour)},
+		{name: "family already over age", familyCreatedAt: now.Add(-refreshFamilyMaxAge - time.Hour), want: now.Add(-time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := refreshTokenExpiry(now, tt.familyCreatedAt)
+			if !got.Equal(tt.want) {
+				t.Errorf("refreshTokenExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,22 +2,23 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
-	"strings"
 
 	"github.com/google/uuid"
 )
 
-func middlewareValidate(next http.HandlerFunc) http.HandlerFunc {
+func (cfg *apiConfig) middlewareValidate(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		const maxChirpLen = 140
 
 		type chirpRequest struct {
-			Body   string    `json:"body"`
-			UserId uuid.UUID `json:"user_id"`
+			Body    string     `json:"body"`
+			UserId  uuid.UUID  `json:"user_id"`
+			ReplyTo *uuid.UUID `json:"reply_to,omitempty"`
 		}
 
 		defer r.Body.Close()
@@ -39,8 +40,12 @@ func middlewareValidate(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		cleaned := cleanBodyFromProf(chp.Body)
-		chp.Body = cleaned
+		result := cfg.moderation.Apply(chp.Body)
+		if result.Rejected {
+			respondWithError(w, 422, "Chirp contains prohibited content", nil)
+			return
+		}
+		chp.Body = result.Body
 		newBody, err := json.Marshal(chp)
 		if err != nil {
 			log.Printf("Failed marshaling new body %v", err)
@@ -48,18 +53,9 @@ func middlewareValidate(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 		r.Body = io.NopCloser(bytes.NewBuffer(newBody))
+		if len(result.Flagged) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), "moderationFlags", result.Flagged))
+		}
 		next.ServeHTTP(w, r)
 	})
 }
-
-func cleanBodyFromProf(s string) string {
-	illegalWords := map[string]struct{}{"kerfuffle": {}, "sharbert": {}, "fornax": {}}
-	words := strings.Split(s, " ")
-	for i, word := range words {
-		if _, ok := illegalWords[strings.ToLower(word)]; ok {
-			words[i] = "****"
-		}
-	}
-	cleaned := strings.Join(words, " ")
-	return cleaned
-}
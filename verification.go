@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mikarwacki/chirpy/internal/auth"
+	"github.com/mikarwacki/chirpy/internal/database"
+	"github.com/mikarwacki/chirpy/internal/mailer"
+)
+
+const emailVerificationTTL = 48 * time.Hour
+
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, user database.User) error {
+	token, err := auth.MakeEmailVerificationToken(user.ID, user.Email, cfg.jwtKeys, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf("Confirm this address by sending the token below to POST /api/users/verify.\n\n%s\n\nThe token expires in %v.",
+			token, emailVerificationTTL),
+	})
+}
+
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type verifyRequest struct {
+		Token string `json:"token"`
+	}
+
+	defer r.Body.Close()
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 500, "Error reading request body", err)
+		return
+	}
+
+	rq := verifyRequest{}
+	err = json.Unmarshal(data, &rq)
+	if err != nil {
+		respondWithError(w, 400, "Error unmarshaling json", err)
+		return
+	}
+
+	userId, email, err := auth.ValidateEmailVerificationToken(rq.Token, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(w, 400, "Invalid or expired verification token", err)
+		return
+	}
+	user, err := cfg.db.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{ID: userId, Email: email})
+	if err != nil {
+		// Already verified, or the address changed since the token was sent.
+		respondWithError(w, 400, "Invalid or expired verification token", err)
+		return
+	}
+	if slices.Contains(cfg.adminEmails, strings.ToLower(user.Email)) {
+		promoted, err := cfg.db.PromoteUsersByEmail(r.Context(), []string{strings.ToLower(user.Email)})
+		if err != nil {
+			respondWithError(w, 500, "Error promoting admin", err)
+			return
+		}
+		if promoted > 0 {
+			user.Role = string(auth.RoleAdmin)
+		}
+	}
+	respondWithJson(w, 200, *NewResponseUser(user, "", ""))
+}
+
+func (cfg *apiConfig) handlerResendVerification(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value("userId").(uuid.UUID)
+
+	user, err := cfg.db.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 404, "User doesn't exist", err)
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(w, 409, "Email already verified", nil)
+		return
+	}
+
+	if !cfg.queueVerificationEmail(user) {
+		respondWithError(w, 503, "Too many emails queued, try again later", nil)
+		return
+	}
+	w.WriteHeader(202)
+}
+
+func (cfg *apiConfig) requireVerifiedEmail(w http.ResponseWriter, r *http.Request, userId uuid.UUID) bool {
+	user, err := cfg.db.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithError(w, 404, "User doesn't exist", err)
+		return false
+	}
+	if !user.EmailVerifiedAt.Valid {
+		respondWithError(w, 403, "Verify your email address before posting", nil)
+		return false
+	}
+	return true
+}
+
+// queueVerificationEmail sends the verification email from the mail queue so
+// a slow mail server doesn't hold up the request. It reports false when the
+// queue is full and nothing was sent.
+func (cfg *apiConfig) queueVerificationEmail(user database.User) bool {
+	queued := cfg.mailQueue.enqueue(func(ctx context.Context) {
+		err := cfg.sendVerificationEmail(ctx, user)
+		if err != nil {
+			log.Printf("Error sending verification email to user %v: %v", user.ID, err)
+		}
+	})
+	if !queued {
+		log.Printf("Mail queue full, dropping verification email for user %v", user.ID)
+	}
+	return queued
+}
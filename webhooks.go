@@ -18,7 +18,6 @@ func (cfg *apiConfig) handlerWebhookPolka(w http.ResponseWriter, r *http.Request
 		} `json:"data"`
 	}
 	apiKey, err := auth.GetAPIKey(r.Header)
-	log.Printf("APIKEY: %v, Error: %v", apiKey, err)
 	if err != nil {
 		respondWithError(w, 401, "Missing apikey", err)
 		return